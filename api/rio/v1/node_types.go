@@ -126,6 +126,38 @@ type VolumeGroup struct {
 	// int and string for its value:
 	// [-1: "", 0: "normal", 1: "contiguous", 2: "cling", 3: "anywhere", 4: "inherited"]
 	AllocationPolicy int `json:"allocationPolicy"`
+
+	// ThinPool is the thin pool of the volume group managed by the driver,
+	// it's created at the first thin provisioned volume of the volume group.
+	// +optional
+	ThinPool *ThinPool `json:"thinPool,omitempty"`
+}
+
+// ThinPool specifies attributes of the thin pool in a volume group.
+type ThinPool struct {
+	// Name of the thin pool logical volume.
+	Name string `json:"name"`
+
+	// Size specifies the data size of the thin pool.
+	Size resource.Quantity `json:"size"`
+	// DataUsed specifies the data space allocated by the thin volumes.
+	DataUsed resource.Quantity `json:"dataUsed"`
+
+	// MetadataSize specifies the metadata size of the thin pool.
+	MetadataSize resource.Quantity `json:"metadataSize"`
+	// MetadataUsed specifies the metadata space used by the thin pool.
+	MetadataUsed resource.Quantity `json:"metadataUsed"`
+
+	// VirtualSize specifies the total size of the thin volumes in the pool,
+	// it's bounded by the overcommit ratio of the pool size.
+	VirtualSize resource.Quantity `json:"virtualSize"`
+
+	// ThinCount denotes number of thin volumes and snapshots in the pool.
+	ThinCount int32 `json:"thinCount"`
+
+	// AutoextendBlocked is true when the pool reaches the autoextend threshold
+	// but the volume group has no free space left for the increment.
+	AutoextendBlocked bool `json:"autoextendBlocked,omitempty"`
 }
 
 //+kubebuilder:object:root=true
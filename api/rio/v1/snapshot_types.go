@@ -44,7 +44,20 @@ type SnapshotSpec struct {
 
 // SnapshotStatus defines the observed state of Snapshot
 type SnapshotStatus struct {
+	// State specifies the current state of the snapshot provisioning request.
+	// +kubebuilder:validation:Enum=Pending;Ready;Failed
 	State string `json:"state,omitempty"`
+
+	// CreationTime is the time the lvm snapshot has been created on the owner node.
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+
+	// Size is the size in bytes of the source volume when the snapshot has been
+	// created, it's the minimum size of the volume restored from the snapshot.
+	Size string `json:"size,omitempty"`
+
+	// Error denotes the error occurred during provisioning a snapshot.
+	// Error field should only be set when State becomes Failed.
+	Error *VolumeError `json:"error,omitempty"`
 }
 
 // +genclient
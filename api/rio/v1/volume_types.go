@@ -62,11 +62,20 @@ type VolumeSpec struct {
 	// +kubebuilder:validation:Enum=yes;no
 	ThinProvision string `json:"thinProvision,omitempty"`
 
+	// ReadOnly specifies whether the volume can only be used read only.
+	// If it is set to "yes", the volume lun is write-protected in its iscsi target.
+	// +kubebuilder:validation:Enum=yes;no
+	ReadOnly string `json:"readOnly,omitempty"`
+
 	DataSource     string               `json:"data_source"`
 	DataSourceType enums.DataSourceType `json:"data_source_type"`
 
 	// +kubebuilder:validation:Optional
 	MountNodes []*mtypes.Info `json:"mount_nodes"`
+	// StageNodes are the nodes where the volume iscsi session is logged in
+	// and the filesystem is mounted at the staging path.
+	// +kubebuilder:validation:Optional
+	StageNodes []*mtypes.StageInfo `json:"stage_nodes,omitempty"`
 	// +kubebuilder:validation:Required
 	IscsiLun int32 `json:"iscsi_lun"`
 	// +kubebuilder:validation:Required
@@ -77,6 +86,10 @@ type VolumeSpec struct {
 	IscsiPortal string `json:"iscsi_portal"`
 	// +kubebuilder:validation:Required
 	IscsiACLIsSet bool `json:"iscsi_acl_is_set"`
+	// PublishedNodes are the nodes the volume is published to by ControllerPublishVolume,
+	// only their initiators are allowed in the volume target ACL.
+	// +kubebuilder:validation:Optional
+	PublishedNodes []string `json:"published_nodes,omitempty"`
 }
 
 // VolumeStatus defines the observed state of Volume
@@ -89,9 +102,38 @@ type VolumeStatus struct {
 	// +kubebuilder:validation:Enum=Pending;Created;Ready;Failed
 	State string `json:"state,omitempty"`
 
+	// Capacity is the size of the logical volume which has actually been
+	// provisioned on the owner node. It catches up with Spec.Capacity after
+	// the volume has been expanded.
+	Capacity string `json:"capacity,omitempty"`
+
 	// Error denotes the error occurred during provisioning/expanding a volume.
 	// Error field should only be set when State becomes Failed.
 	Error *VolumeError `json:"error,omitempty"`
+
+	// Retries is the count of failed provisioning attempts on the owner node,
+	// the volume becomes Failed when it reaches the retry budget.
+	Retries int32 `json:"retries,omitempty"`
+
+	// LastRetryTime is the time of the last failed provisioning attempt, the
+	// next attempt waits for the retry backoff since then.
+	LastRetryTime *metav1.Time `json:"lastRetryTime,omitempty"`
+
+	// Condition is the health of the logical volume and its iscsi target,
+	// it's checked periodically by the owner node.
+	Condition *VolumeCondition `json:"condition,omitempty"`
+
+	// PublishedNodes are the nodes whose initiators have been set in the
+	// volume target ACL by the owner node.
+	PublishedNodes []string `json:"publishedNodes,omitempty"`
+}
+
+// VolumeCondition specifies the health condition of a volume.
+type VolumeCondition struct {
+	// Abnormal is true when the volume is not healthy
+	Abnormal bool `json:"abnormal"`
+	// Message describes the abnormal condition of the volume
+	Message string `json:"message,omitempty"`
 }
 
 // VolumeError specifies the error occurred during volume provisioning.
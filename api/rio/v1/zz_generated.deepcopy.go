@@ -111,7 +111,7 @@ func (in *Snapshot) DeepCopyInto(out *Snapshot) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Snapshot.
@@ -182,6 +182,15 @@ func (in *SnapshotSpec) DeepCopy() *SnapshotSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SnapshotStatus) DeepCopyInto(out *SnapshotStatus) {
 	*out = *in
+	if in.CreationTime != nil {
+		in, out := &in.CreationTime, &out.CreationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Error != nil {
+		in, out := &in.Error, &out.Error
+		*out = new(VolumeError)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotStatus.
@@ -194,6 +203,26 @@ func (in *SnapshotStatus) DeepCopy() *SnapshotStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ThinPool) DeepCopyInto(out *ThinPool) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+	out.DataUsed = in.DataUsed.DeepCopy()
+	out.MetadataSize = in.MetadataSize.DeepCopy()
+	out.MetadataUsed = in.MetadataUsed.DeepCopy()
+	out.VirtualSize = in.VirtualSize.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ThinPool.
+func (in *ThinPool) DeepCopy() *ThinPool {
+	if in == nil {
+		return nil
+	}
+	out := new(ThinPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Volume) DeepCopyInto(out *Volume) {
 	*out = *in
@@ -221,6 +250,21 @@ func (in *Volume) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeCondition) DeepCopyInto(out *VolumeCondition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeCondition.
+func (in *VolumeCondition) DeepCopy() *VolumeCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VolumeError) DeepCopyInto(out *VolumeError) {
 	*out = *in
@@ -243,6 +287,11 @@ func (in *VolumeGroup) DeepCopyInto(out *VolumeGroup) {
 	out.Free = in.Free.DeepCopy()
 	out.MetadataFree = in.MetadataFree.DeepCopy()
 	out.MetadataSize = in.MetadataSize.DeepCopy()
+	if in.ThinPool != nil {
+		in, out := &in.ThinPool, &out.ThinPool
+		*out = new(ThinPool)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeGroup.
@@ -290,6 +339,11 @@ func (in *VolumeList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VolumeSpec) DeepCopyInto(out *VolumeSpec) {
 	*out = *in
+	if in.PublishedNodes != nil {
+		in, out := &in.PublishedNodes, &out.PublishedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSpec.
@@ -310,6 +364,20 @@ func (in *VolumeStatus) DeepCopyInto(out *VolumeStatus) {
 		*out = new(VolumeError)
 		**out = **in
 	}
+	if in.LastRetryTime != nil {
+		in, out := &in.LastRetryTime, &out.LastRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Condition != nil {
+		in, out := &in.Condition, &out.Condition
+		*out = new(VolumeCondition)
+		**out = **in
+	}
+	if in.PublishedNodes != nil {
+		in, out := &in.PublishedNodes, &out.PublishedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeStatus.
@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"os"
 	"os/signal"
 	"qiniu.io/rio-csi/generated/informer/externalversions"
 	clientset "qiniu.io/rio-csi/generated/internalclientset"
+	"sync"
 	"syscall"
 )
 
@@ -23,7 +26,12 @@ type KubeClient struct {
 var (
 	DefaultClient   *KubeClient
 	DefaultInformer externalversions.SharedInformerFactory
-	Codecs          serializer.CodecFactory
+	// DefaultKubeInformer informs the kubernetes resources, its informers are started on demand
+	DefaultKubeInformer informers.SharedInformerFactory
+	Codecs              serializer.CodecFactory
+
+	informerStopCh   chan struct{}
+	nodeInformerOnce sync.Once
 )
 
 func SetupClusterConfig() {
@@ -39,7 +47,9 @@ func SetupClusterConfig() {
 
 func initInformer() {
 	DefaultInformer = externalversions.NewSharedInformerFactory(DefaultClient.InternalClientSet, 0)
+	DefaultKubeInformer = informers.NewSharedInformerFactory(DefaultClient.ClientSet, 0)
 	stopCh := make(chan struct{})
+	informerStopCh = stopCh
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, []os.Signal{os.Interrupt, syscall.SIGTERM}...)
 	go func() {
@@ -56,6 +66,18 @@ func initInformer() {
 	DefaultInformer.WaitForCacheSync(stopCh)
 }
 
+// NodeLister returns the lister of the kubernetes nodes, the node informer is started at the first call
+// so that only the components reading nodes watch them
+func NodeLister() corelisters.NodeLister {
+	nodeInformerOnce.Do(func() {
+		DefaultKubeInformer.Core().V1().Nodes().Informer()
+		DefaultKubeInformer.Start(informerStopCh)
+		DefaultKubeInformer.WaitForCacheSync(informerStopCh)
+	})
+
+	return DefaultKubeInformer.Core().V1().Nodes().Lister()
+}
+
 // NewDefault TODO master url
 func NewDefault(masterUrl, kubeConfigPath string) (c *KubeClient, err error) {
 	config, err := clientcmd.BuildConfigFromFlags(masterUrl, kubeConfigPath)
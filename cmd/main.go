@@ -8,9 +8,11 @@ import (
 	"qiniu.io/rio-csi/conf"
 	"qiniu.io/rio-csi/driver"
 	"qiniu.io/rio-csi/lib/iscsi"
+	"qiniu.io/rio-csi/lib/lvm"
 	"qiniu.io/rio-csi/lib/mount"
 	"qiniu.io/rio-csi/logger"
 	"qiniu.io/rio-csi/manager"
+	"qiniu.io/rio-csi/metrics"
 	"syscall"
 	"time"
 )
@@ -37,6 +39,7 @@ var (
 	nodeID      string
 	metricsAddr string
 	probeAddr   string
+	debugAddr   string
 
 	//iscsiUsername string
 	//iscsiPasswd   string
@@ -58,6 +61,8 @@ var (
 		Short:   "CSI based rio csi driver",
 		Version: Version,
 		Run: func(cmd *cobra.Command, args []string) {
+			client.SetupClusterConfig()
+
 			config, err := conf.LoadConfig(namespace)
 			if err != nil {
 				logger.StdLog.Error(err)
@@ -65,6 +70,7 @@ var (
 			}
 
 			mount.SetIORateLimits(config)
+			lvm.SetThinPoolPolicy(config)
 
 			driverType = DriverType(driverTypeStr)
 			logger.StdLog.Info("start ", driverType, nodeID, endpoint, config.IscsiUsername)
@@ -78,12 +84,15 @@ var (
 					return
 				}
 
+				metrics.Start(config, metrics.NewLVMCollector(nodeID), metrics.NewIscsiCollector(nodeID))
+
 				go func() {
 					driver.NewCSIDriver(
 						name,
 						Version,
 						nodeID,
 						endpoint,
+						"",
 						config.IscsiUsername,
 						config.IscsiPasswd,
 						true,
@@ -96,12 +105,14 @@ var (
 					probeAddr, config.IscsiUsername, config.IscsiPasswd, stopCh)
 
 			case DriverTypeControl:
+				metrics.Start(config)
 
 				driver.NewCSIDriver(
 					name,
 					Version,
 					nodeID,
 					endpoint,
+					debugAddr,
 					config.IscsiUsername,
 					config.IscsiPasswd,
 					true,
@@ -121,8 +132,6 @@ func init() {
 var stopCh chan struct{}
 
 func main() {
-	client.SetupClusterConfig()
-
 	go func() {
 		sigs := make(chan os.Signal, 1)
 		signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
@@ -151,27 +160,31 @@ func Execute() {
 func setRootCMD() {
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable debug log")
 
-	rootCmd.PersistentFlags().StringVar(&nodeID, "nodeid", "", "CSI Node ID")
-	_ = rootCmd.MarkPersistentFlagRequired("nodeid")
+	// the flags of the driver are not inherited by the sub commands
+	rootCmd.Flags().StringVar(&nodeID, "nodeid", "", "CSI Node ID")
+	_ = rootCmd.MarkFlagRequired("nodeid")
 
-	rootCmd.PersistentFlags().StringVar(&endpoint, "endpoint", "unix:///csi/csi.sock", "CSI gRPC Server Endpoint")
-	_ = rootCmd.MarkPersistentFlagRequired("endpoint")
+	rootCmd.Flags().StringVar(&endpoint, "endpoint", "unix:///csi/csi.sock", "CSI gRPC Server Endpoint")
+	_ = rootCmd.MarkFlagRequired("endpoint")
 
-	rootCmd.PersistentFlags().StringVar(&name, "name", "rio-csi", "CSI Driver Name")
-	_ = rootCmd.PersistentFlags().MarkHidden("name")
+	rootCmd.Flags().StringVar(&name, "name", "rio-csi", "CSI Driver Name")
+	_ = rootCmd.Flags().MarkHidden("name")
 
-	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", "riocsi", "CSI Driver namespace")
-	_ = rootCmd.MarkPersistentFlagRequired("namespace")
-	_ = rootCmd.PersistentFlags().MarkHidden("namespace")
+	rootCmd.Flags().StringVar(&namespace, "namespace", "riocsi", "CSI Driver namespace")
+	_ = rootCmd.MarkFlagRequired("namespace")
+	_ = rootCmd.Flags().MarkHidden("namespace")
 
 	rootCmd.PersistentFlags().StringVar(&Version, "version", "v1.0", "CSI Driver Version")
 	_ = rootCmd.PersistentFlags().MarkHidden("version")
 
-	rootCmd.PersistentFlags().StringVar(&driverTypeStr, "driverType", "node", "set driver type node or control")
-	_ = rootCmd.MarkPersistentFlagRequired("driverType")
+	rootCmd.Flags().StringVar(&driverTypeStr, "driverType", "node", "set driver type node or control")
+	_ = rootCmd.MarkFlagRequired("driverType")
+
+	rootCmd.Flags().StringVar(&metricsAddr, "metricsAddr", ":9180", "set metrics addr")
+	rootCmd.Flags().StringVar(&probeAddr, "probeAddr", ":9181", "set probe addr")
+	rootCmd.Flags().StringVar(&debugAddr, "debugAddr", "127.0.0.1:9182", "set scheduler debug addr of the control driver, empty to disable")
 
-	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metricsAddr", ":9180", "set metrics addr")
-	rootCmd.PersistentFlags().StringVar(&probeAddr, "probeAddr", ":9181", "set probe addr")
+	rootCmd.AddCommand(newSchedulerCmd())
 
 	//rootCmd.SetVersionTemplate(fmt.Sprintf(versionTpl, name, Version, runtime.GOOS+"/"+runtime.GOARCH, BuildDate, CommitID))
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"qiniu.io/rio-csi/driver"
+	"qiniu.io/rio-csi/driver/dparams"
+	"qiniu.io/rio-csi/driver/scheduler"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// explainOptions are the flags of the scheduler explain command
+type explainOptions struct {
+	server            string
+	name              string
+	vgPattern         string
+	volGroup          string
+	size              string
+	scheduler         string
+	node              string
+	spreadGroup       string
+	spreadMode        string
+	spreadTopologyKey string
+	output            string
+}
+
+func newSchedulerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scheduler",
+		Short: "Debug the volume scheduler of the control driver",
+	}
+
+	cmd.AddCommand(newExplainCmd())
+	return cmd
+}
+
+func newExplainCmd() *cobra.Command {
+	opts := &explainOptions{}
+	cmd := &cobra.Command{
+		Use:          "explain",
+		Short:        "Dump the node views of a vgpattern and simulate the placement of a volume",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExplain(opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.server, "server", "http://127.0.0.1:9182", "debug server addr of the control driver")
+	cmd.Flags().StringVar(&opts.name, "name", "", "name of the simulated volume, the nodes it failed on are filtered")
+	cmd.Flags().StringVar(&opts.vgPattern, "vgpattern", "", "vgpattern of the storage class")
+	cmd.Flags().StringVar(&opts.volGroup, "volgroup", "", "volgroup of the storage class")
+	cmd.Flags().StringVar(&opts.size, "size", "0", "size of the simulated volume, eg. 10Gi")
+	cmd.Flags().StringVar(&opts.scheduler, "scheduler", "", "scheduler of the storage class")
+	cmd.Flags().StringVar(&opts.node, "node", "", "limit the volume to the node like a WaitForFirstConsumer pvc")
+	cmd.Flags().StringVar(&opts.spreadGroup, "spreadgroup", "", "spread group of the simulated volume")
+	cmd.Flags().StringVar(&opts.spreadMode, "spreadmode", "", "spread mode hard or soft")
+	cmd.Flags().StringVar(&opts.spreadTopologyKey, "spreadtopologykey", "", "node label of the topology domain to spread across")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "output format, table or json")
+	return cmd
+}
+
+// query returns the query params of the explain endpoint, the empty flags are omitted
+func (opts *explainOptions) query() url.Values {
+	query := url.Values{}
+	params := map[string]string{
+		"name":              opts.name,
+		"vgpattern":         opts.vgPattern,
+		"volgroup":          opts.volGroup,
+		"size":              opts.size,
+		"scheduler":         opts.scheduler,
+		"node":              opts.node,
+		"spreadgroup":       opts.spreadGroup,
+		"spreadmode":        opts.spreadMode,
+		"spreadtopologykey": opts.spreadTopologyKey,
+	}
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	return query
+}
+
+func runExplain(opts *explainOptions) error {
+	if opts.vgPattern == "" && opts.volGroup == "" {
+		return fmt.Errorf("vgpattern or volgroup is required")
+	}
+
+	server := strings.TrimSuffix(opts.server, "/")
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	resp, err := httpClient.Get(server + driver.ExplainPath + "?" + opts.query().Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("explain error %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if opts.output == "json" {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+
+	explanation := &scheduler.Explanation{}
+	if err = json.Unmarshal(body, explanation); err != nil {
+		return err
+	}
+
+	printExplanation(os.Stdout, explanation)
+	return nil
+}
+
+// printExplanation prints the node views in the scheduling order and the result of every node
+func printExplanation(out io.Writer, e *scheduler.Explanation) {
+	fmt.Fprintf(out, "VgPattern: %s\nScheduler: %s\nRequired: %d\n\n", e.VgPattern, e.Scheduler, e.RequiredBytes)
+
+	results := make(map[string]*scheduler.FilterResult, len(e.Results))
+	for _, result := range e.Results {
+		results[result.NodeName] = result
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSCORE\tVOLUME WEIGHTED\tCAPACITY WEIGHTED\tSPACE WEIGHTED\tVOLUMES\tPENDING VOLUMES\tPENDING SNAPSHOTS\tMAX FREE\tVG\tREASON")
+	for _, node := range e.Nodes {
+		vgName, reason := "", ""
+		if result, ok := results[node.NodeName]; ok {
+			vgName, reason = result.VgName, result.Reason
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", node.NodeName, node.Score,
+			node.Scores[dparams.VolumeWeighted], node.Scores[dparams.CapacityWeighted], node.Scores[dparams.SpaceWeighted],
+			node.VolumeNum, node.PendingVolumeNum, node.PendingSnapshotNum, node.MaxFree.String(), vgName, reason)
+	}
+	_ = w.Flush()
+
+	if e.Error != "" {
+		fmt.Fprintf(out, "\nResult: %s\n", e.Error)
+		return
+	}
+
+	fmt.Fprintf(out, "\nResult: node %s vg %s\n", e.NodeName, e.VgName)
+}
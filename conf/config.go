@@ -62,4 +62,18 @@ type Config struct {
 	IscsiUsername string `yaml:"iscsi_username"`
 	// IscsiPasswd specific iscsi password for iscsi auth
 	IscsiPasswd string `yaml:"iscsi_passwd"`
+
+	// ThinPoolSize is the size of the thin pool created in a volume group at its first thin volume,
+	// a percentage of the volume group size eg. "90%" or a quantity eg. "500Gi". Default is 90%
+	ThinPoolSize string `yaml:"thin_pool_size"`
+	// ThinPoolMetadataSize is the metadata size of the thin pool eg. "1Gi", lvm picks it if empty
+	ThinPoolMetadataSize string `yaml:"thin_pool_metadata_size"`
+	// ThinOvercommitRatio bounds the total size of the thin volumes in a pool to the ratio of
+	// the pool size, eg. 2.0 allows twice the pool size. 0 means unbounded
+	ThinOvercommitRatio float64 `yaml:"thin_overcommit_ratio"`
+	// ThinPoolAutoextendThreshold extends the thin pool when its data or metadata usage reaches
+	// the percentage, 0 disables autoextend
+	ThinPoolAutoextendThreshold int `yaml:"thin_pool_autoextend_threshold"`
+	// ThinPoolAutoextendPercent is the percentage of its size the thin pool is extended by. Default is 20
+	ThinPoolAutoextendPercent int `yaml:"thin_pool_autoextend_percent"`
 }
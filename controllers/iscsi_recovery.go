@@ -9,6 +9,7 @@ import (
 	"qiniu.io/rio-csi/client"
 	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/lib/iscsi"
+	"qiniu.io/rio-csi/lib/lvm"
 	"qiniu.io/rio-csi/lib/mount"
 	"qiniu.io/rio-csi/lib/mount/mtypes"
 	"qiniu.io/rio-csi/logger"
@@ -46,7 +47,7 @@ func CheckAndRecoveryDisk(nodeID, iscsiUsername, iscsiPassword string) {
 	for {
 		resp, conStr, err := crd.ListVolumes(skip, limit)
 		if err != nil {
-			logger.StdLog.Errorf("ListVolumes skip %d limit %d error %v", skip, limit, err)
+			logger.StdLog.Errorf("ListVolumes skip %s limit %d error %v", skip, limit, err)
 			return
 		}
 
@@ -55,15 +56,13 @@ func CheckAndRecoveryDisk(nodeID, iscsiUsername, iscsiPassword string) {
 				CheckAndRecoveryDiskIscsi(vol, iscsiUsername, iscsiPassword, targetsMap)
 			}
 
-			for _, no := range vol.Spec.MountNodes {
-				if no.PodInfo.NodeId == nodeID {
-					// volume session not exist on this node do recovery
-					if _, ok := sessionMap[vol.Spec.IscsiTarget]; !ok {
-						RecoveryDiskIscsiSession(&vol, no, iscsiUsername, iscsiPassword)
-					}
-
-					// recovery once then exist because one vol may mount many pod on the same node
-					break
+			// volume session not exist on this node do recovery, the session
+			// is shared by all the pods on the node so recovery once is enough,
+			// local volume on the owner node has no session
+			stageInfo := mount.GetStageInfo(&vol, nodeID)
+			if stageInfo != nil && stageInfo.VolumeInfo != nil && !stageInfo.VolumeInfo.Local {
+				if _, ok := sessionMap[vol.Spec.IscsiTarget]; !ok {
+					RecoveryDiskIscsiSession(&vol, stageInfo, iscsiUsername, iscsiPassword)
 				}
 			}
 		}
@@ -77,54 +76,72 @@ func CheckAndRecoveryDisk(nodeID, iscsiUsername, iscsiPassword string) {
 	logger.StdLog.Info("Check Disk IScsi Finish")
 }
 
-// RecoveryDiskIscsiSession recovery iscsi session
-func RecoveryDiskIscsiSession(vol *apis.Volume, info *mtypes.Info, iscsiUsername, iscsiPassword string) {
+// RecoveryDiskIscsiSession recovery iscsi session, the volume is staged again and
+// bind mounted to the pods on the node
+func RecoveryDiskIscsiSession(vol *apis.Volume, stageInfo *mtypes.StageInfo, iscsiUsername, iscsiPassword string) {
 	// check target abnormal return
-	if vol.Spec.IscsiTarget == "" {
+	if vol.Spec.IscsiTarget == "" || stageInfo.VolumeInfo == nil {
 		return
 	}
 
 	// checkout pods exist if pod not exist do not recovery and remove old mount info
-	_, err := client.DefaultClient.ClientSet.CoreV1().Pods(info.PodInfo.Namespace).Get(context.Background(), info.PodInfo.Name, metav1.GetOptions{})
-	if err != nil && k8serror.IsNotFound(err) {
-		// if pod is not exist
-		newMountNodes := make([]*mtypes.Info, 0, 5)
-		isRemoved := false
-		for _, v := range vol.Spec.MountNodes {
-			if v.PodInfo.NodeId == info.PodInfo.NodeId && v.VolumeInfo.MountPath == info.VolumeInfo.MountPath && !isRemoved {
-				isRemoved = true
-				continue
-			}
-
+	newMountNodes := make([]*mtypes.Info, 0, len(vol.Spec.MountNodes))
+	podInfos := make([]*mtypes.Info, 0, len(vol.Spec.MountNodes))
+	for _, v := range vol.Spec.MountNodes {
+		if v.PodInfo == nil || v.PodInfo.NodeId != stageInfo.NodeId {
 			newMountNodes = append(newMountNodes, v)
+			continue
 		}
 
-		vol.Spec.MountNodes = newMountNodes
+		_, err := client.DefaultClient.ClientSet.CoreV1().Pods(v.PodInfo.Namespace).Get(context.Background(), v.PodInfo.Name, metav1.GetOptions{})
+		if err != nil && k8serror.IsNotFound(err) {
+			continue
+		}
 
-		vol, err = crd.UpdateVolume(vol)
+		newMountNodes = append(newMountNodes, v)
 		if err != nil {
-			logger.StdLog.Errorf("update volume %s mount nodes error %v", vol.Name, err)
+			logger.StdLog.Errorf("recovery disk %s check volume pod %s with error %v", vol.Name, v.PodInfo.Name, err)
+			continue
 		}
 
-		return
+		podInfos = append(podInfos, v)
 	}
 
-	if err != nil {
-		logger.StdLog.Errorf("recovery disk %s check volume pod %s with error %v", info.PodInfo.Name, vol.Name, err)
-		return
+	if len(newMountNodes) != len(vol.Spec.MountNodes) {
+		vol.Spec.MountNodes = newMountNodes
+		newVol, err := crd.UpdateVolume(vol)
+		if err != nil {
+			logger.StdLog.Errorf("update volume %s mount nodes error %v", vol.Name, err)
+			return
+		}
+		*vol = *newVol
 	}
 
-	err = mount.UmountVolume(vol, info.VolumeInfo.MountPath, iscsiUsername, iscsiPassword, nil, false)
-	if err != nil {
-		logger.StdLog.Errorf("recovery disk %s unmount volume with error %v", vol.Name, err)
+	for _, info := range podInfos {
+		err := mount.UmountVolume(vol, info.VolumeInfo.MountPath, iscsiUsername, iscsiPassword, nil, false)
+		if err != nil {
+			logger.StdLog.Errorf("recovery disk %s unmount volume path %s with error %v", vol.Name, info.VolumeInfo.MountPath, err)
+		}
 	}
 
-	err = mount.MountVolume(vol, info, iscsiUsername, iscsiPassword)
+	stagingPath := stageInfo.VolumeInfo.MountPath
+	if err := mount.UnmountPath(stagingPath); err != nil {
+		logger.StdLog.Errorf("recovery disk %s unmount staging path %s with error %v", vol.Name, stagingPath, err)
+	}
+
+	err := mount.StageVolume(vol, stageInfo, iscsiUsername, iscsiPassword)
 	if err != nil {
-		logger.StdLog.Errorf("recovery disk %s iscsi session node %s pod %s with error %v",
-			vol.Name, info.PodInfo.NodeId, info.PodInfo.Name, err)
+		logger.StdLog.Errorf("recovery disk %s iscsi session node %s with error %v", vol.Name, stageInfo.NodeId, err)
+		return
 	}
 
+	for _, info := range podInfos {
+		err = mount.PublishVolume(vol, info, stagingPath)
+		if err != nil {
+			logger.StdLog.Errorf("recovery disk %s publish node %s pod %s with error %v",
+				vol.Name, info.PodInfo.NodeId, info.PodInfo.Name, err)
+		}
+	}
 }
 
 // CheckAndRecoveryDiskIscsi check disk status and do iscsi recovery
@@ -142,14 +159,14 @@ func CheckAndRecoveryDiskIscsi(vol apis.Volume, iscsiUsername, iscsiPassword str
 	}
 
 	// check ACL
-	err = CreateTargetAcl(vol.Namespace, vol.Spec.IscsiTarget, iscsiUsername, iscsiPassword)
+	err = SyncTargetAcl(vol.Namespace, vol.Spec.IscsiTarget, getAclNodes(&vol), iscsiUsername, iscsiPassword)
 	if err != nil {
-		logger.StdLog.Error(err, fmt.Sprintf("CheckAndRecoveryDisk: CreateTargetAcl %v", err))
+		logger.StdLog.Error(err, fmt.Sprintf("CheckAndRecoveryDisk: SyncTargetAcl %v", err))
 	}
 
 	// public block device
 	device := getVolumeDevice(&vol)
-	_, err = iscsi.PublicBlockDevice(vol.Name, device)
+	_, err = iscsi.PublicBlockDevice(vol.Name, device, vol.Spec.ReadOnly == lvm.YES)
 	if err != nil {
 		logger.StdLog.Error(err, fmt.Sprintf("PublicBlockDevice target %s, vol %s, device %s error: %v",
 			vol.Spec.IscsiTarget, vol.Name, device, err))
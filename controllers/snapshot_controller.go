@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	riov1 "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/lib/lvm"
@@ -109,14 +110,34 @@ func (r *SnapshotReconciler) syncSnapshot(ctx context.Context, snap *riov1.Snaps
 	err = lvm.CreateSnapshot(snap)
 	if err != nil {
 		logger.StdLog.Error(err)
+		snap.Status.Error = transformLVMError(err)
 		_, err = crd.UpdateSnapInfo(snap, crd.StatusFailed)
 		return err
 	}
 
+	now := metav1.Now()
+	snap.Status.CreationTime = &now
+	snap.Status.Size = r.getSourceVolumeSize(snap)
+	snap.Status.Error = nil
 	_, err = crd.UpdateSnapInfo(snap, crd.StatusReady)
 	return err
 }
 
+// getSourceVolumeSize returns the size of volume the snapshot taken from
+func (r *SnapshotReconciler) getSourceVolumeSize(snap *riov1.Snapshot) string {
+	vol, err := crd.GetVolume(snap.Labels[crd.VolKey])
+	if err != nil {
+		logger.StdLog.Errorf("get snapshot %s source volume %s error %v", snap.Name, snap.Labels[crd.VolKey], err)
+		return ""
+	}
+
+	if vol.Status.Capacity != "" {
+		return vol.Status.Capacity
+	}
+
+	return vol.Spec.Capacity
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *SnapshotReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
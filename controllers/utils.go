@@ -1,23 +1,49 @@
 package controllers
 
 import (
-	"errors"
 	"golang.org/x/net/context"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apis "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/client"
 	"qiniu.io/rio-csi/lib/iscsi"
 	"qiniu.io/rio-csi/logger"
 )
 
-// CreateTargetAcl check target whether exist, if not create
-// TODO add initiator acl rules partial not all
-func CreateTargetAcl(namespace, target, username, password string) (err error) {
+// SyncTargetAcl makes the target acl only contain the initiators of the nodes
+func SyncTargetAcl(namespace, target string, nodeIDs []string, username, password string) (err error) {
 	nodes, listErr := client.DefaultClient.InternalClientSet.RioV1().RioNodes(namespace).List(context.TODO(), metav1.ListOptions{})
 	if listErr != nil {
-		logger.StdLog.Errorf("list %s rio node info error %v", namespace, err)
+		logger.StdLog.Errorf("list %s rio node info error %v", namespace, listErr)
 		return listErr
 	}
 
+	nodeMap := make(map[string]bool)
+	for _, nodeID := range nodeIDs {
+		nodeMap[nodeID] = true
+	}
+
+	initiatorMap := make(map[string]bool)
+	for _, node := range nodes.Items {
+		if !nodeMap[node.Name] {
+			continue
+		}
+
+		// a node without initiator or sharing it with another node is skipped, so that it
+		// doesnt block the access of the other nodes
+		initiator := node.ISCSIInfo.InitiatorName
+		if initiator == "" {
+			logger.StdLog.Warnf("target %s node %s has no initiator, skip it", target, node.Name)
+			continue
+		}
+
+		if initiatorMap[initiator] {
+			logger.StdLog.Warnf("target %s node %s initiator %s is duplicated, skip it", target, node.Name, initiator)
+			continue
+		}
+
+		initiatorMap[initiator] = true
+	}
+
 	currentAclList, err := iscsi.ListTargetAcl(target)
 	if err != nil {
 		logger.StdLog.Errorf("ListTargetAcl %s error %v", target, err)
@@ -27,30 +53,67 @@ func CreateTargetAcl(namespace, target, username, password string) (err error) {
 	aclMap := make(map[string]bool)
 	for _, v := range currentAclList {
 		aclMap[v] = true
+		if initiatorMap[v] {
+			continue
+		}
+
+		// remove the initiator of node which volume isn't published to
+		_, err = iscsi.DeleteTargetAcl(target, v)
+		if err != nil {
+			logger.StdLog.Errorf("DeleteTargetAcl target %s initiator %s error %v", target, v, err)
+			return err
+		}
 	}
 
-	count := 0
-	for _, node := range nodes.Items {
-		if aclMap[node.ISCSIInfo.InitiatorName] {
-			count++
+	for initiator := range initiatorMap {
+		if aclMap[initiator] {
 			continue
 		}
 
 		// not exist create
-		_, err = iscsi.SetUpTargetAcl(target, node.ISCSIInfo.InitiatorName, username, password)
+		_, err = iscsi.SetUpTargetAcl(target, initiator, username, password)
 		if err != nil {
-			logger.StdLog.Errorf("SetUpTargetAcl target %s initiator %s error %v", target, node.ISCSIInfo.InitiatorName, err)
+			logger.StdLog.Errorf("SetUpTargetAcl target %s initiator %s error %v", target, initiator, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getAclNodes returns the nodes allowed to access the volume target, they are the nodes
+// volume is published to and the nodes still staging or mounting it
+func getAclNodes(vol *apis.Volume) []string {
+	nodeIDs := make([]string, 0, len(vol.Spec.PublishedNodes))
+	exists := make(map[string]bool)
+	for _, nodeID := range vol.Spec.PublishedNodes {
+		if !exists[nodeID] {
+			exists[nodeID] = true
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+	}
+
+	for _, info := range vol.Spec.MountNodes {
+		if info == nil || info.PodInfo == nil || info.PodInfo.NodeId == "" {
 			continue
 		}
 
-		// success
-		count++
+		if !exists[info.PodInfo.NodeId] {
+			exists[info.PodInfo.NodeId] = true
+			nodeIDs = append(nodeIDs, info.PodInfo.NodeId)
+		}
 	}
 
-	// if all initiator is set dot check anymore
-	if count == len(nodes.Items) {
-		return nil
+	for _, info := range vol.Spec.StageNodes {
+		if info == nil || info.NodeId == "" {
+			continue
+		}
+
+		if !exists[info.NodeId] {
+			exists[info.NodeId] = true
+			nodeIDs = append(nodeIDs, info.NodeId)
+		}
 	}
 
-	return errors.New("acl not set all for the nodes")
+	return nodeIDs
 }
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/lib/mount/mtypes"
+	"reflect"
+	"testing"
+)
+
+func Test_getAclNodes(t *testing.T) {
+	tests := []struct {
+		name string
+		spec apis.VolumeSpec
+		want []string
+	}{
+		{
+			name: "no node",
+			spec: apis.VolumeSpec{},
+			want: []string{},
+		},
+		{
+			name: "published nodes",
+			spec: apis.VolumeSpec{PublishedNodes: []string{"node1", "node2", "node1"}},
+			want: []string{"node1", "node2"},
+		},
+		{
+			name: "nodes still mounting and staging the volume",
+			spec: apis.VolumeSpec{
+				PublishedNodes: []string{"node1"},
+				MountNodes: []*mtypes.Info{
+					{PodInfo: &mtypes.PodInfo{NodeId: "node2"}},
+					{PodInfo: &mtypes.PodInfo{NodeId: "node1"}},
+					{PodInfo: nil},
+					nil,
+				},
+				StageNodes: []*mtypes.StageInfo{{NodeId: "node3"}, {NodeId: "node2"}, {NodeId: ""}, nil},
+			},
+			want: []string{"node1", "node2", "node3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vol := &apis.Volume{Spec: tt.spec}
+			if got := getAclNodes(vol); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getAclNodes() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
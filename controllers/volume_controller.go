@@ -18,6 +18,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	riov1 "qiniu.io/rio-csi/api/rio/v1"
@@ -33,13 +34,25 @@ import (
 	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	// maxProvisionRetries is the retry budget of the volume provisioning on the owner node
+	maxProvisionRetries = 5
+	// provisionRetryInterval is the backoff after the first failed provisioning attempt, it doubles every retry
+	provisionRetryInterval = 30 * time.Second
+)
+
+// errInsufficientCapacity means no vg of the node can fit the volume, it's not retried
+var errInsufficientCapacity = errors.New("insufficient capacity")
+
 // VolumeReconciler reconciles a Volume object
 type VolumeReconciler struct {
 	client.Client
@@ -85,6 +98,11 @@ func (r *VolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, nil
 	}
 
+	// the status update of a failed attempt triggers the reconcile at once, wait for the backoff
+	if wait := provisionBackoff(&vol, time.Now()); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
 	err = r.syncVol(ctx, &vol)
 	if err != nil {
 		logger.StdLog.Error("sync vol error", err)
@@ -115,12 +133,20 @@ func (r *VolumeReconciler) syncVol(ctx context.Context, vol *riov1.Volume) error
 		return nil
 	case crd.StatusReady:
 		l.Info("lvm volume already provisioned")
-		return nil
+		// ephemeral volume has no iscsi target to publish
+		if !crd.IsEphemeralVolume(vol) {
+			vol, err = r.publishVolume(ctx, vol)
+			if err != nil {
+				return err
+			}
+		}
+
+		return r.expandVolume(ctx, vol)
 	case crd.StatusCreated:
 		err = r.cloneFromSource(ctx, vol)
 		if err != nil {
-			logger.StdLog.Error(err, "cloneFromSource", vol.Name)
-			return err
+			logger.StdLog.Errorf("cloneFromSource %s, error %v", vol.Name, err)
+			return r.handleProvisionError(vol, err)
 		}
 
 		return nil
@@ -129,51 +155,95 @@ func (r *VolumeReconciler) syncVol(ctx context.Context, vol *riov1.Volume) error
 	err = r.createVolume(ctx, vol)
 	if err != nil {
 		logger.StdLog.Errorf("createVolume %s, error %v", vol.Name, err)
-		return err
+		return r.handleProvisionError(vol, err)
 	}
 
 	err = r.cloneFromSource(ctx, vol)
 	if err != nil {
 		logger.StdLog.Errorf("cloneFromSource %s, error %v", vol.Name, err)
+		return r.handleProvisionError(vol, err)
+	}
+
+	return nil
+}
+
+// handleProvisionError records the provisioning error of the volume. In case no vg available
+// or the retry budget is used up, mark the volume provisioning failed so that controller
+// can reschedule it, the partially created resources are cleaned when the volume is deleted.
+func (r *VolumeReconciler) handleProvisionError(vol *riov1.Volume, provisionErr error) error {
+	newVol, err := crd.GetVolume(vol.Name)
+	if err != nil {
+		logger.StdLog.Errorf("GetVolume %s error %v", vol.Name, err)
 		return err
 	}
 
-	// TODO retry check and turn into failed status
+	newVol.Status.Error = transformLVMError(provisionErr)
+	newVol.Status.Retries++
+	now := metav1.Now()
+	newVol.Status.LastRetryTime = &now
+	newVol, err = crd.UpdateVolumeStatus(newVol)
 	if err != nil {
-		// In case no vg available or lvm.CreateLVMVolume fails for all vgs, mark
-		// the volume provisioning failed so that controller can reschedule it.
-		vol.Status.Error = r.transformLVMError(err)
-		return crd.UpdateVolInfoWithStatus(vol, crd.StatusFailed)
+		logger.StdLog.Errorf("UpdateVolumeStatus %s error %v", vol.Name, err)
+		return err
 	}
 
-	return nil
+	if newVol.Status.Error.Code != riov1.InsufficientCapacity && newVol.Status.Retries < maxProvisionRetries {
+		return provisionErr
+	}
+
+	logger.StdLog.Errorf("volume %s provisioning failed after %d retries: %v", vol.Name, newVol.Status.Retries, provisionErr)
+	return crd.UpdateVolInfoWithStatus(newVol, crd.StatusFailed)
+}
+
+// provisionBackoff returns how long the volume has to wait before the next provisioning attempt
+func provisionBackoff(vol *riov1.Volume, now time.Time) time.Duration {
+	if vol.DeletionTimestamp != nil || vol.Status.LastRetryTime == nil || vol.Status.Retries <= 0 {
+		return 0
+	}
+
+	if vol.Status.State == crd.StatusReady || vol.Status.State == crd.StatusFailed {
+		return 0
+	}
+
+	backoff := provisionRetryInterval << (vol.Status.Retries - 1)
+	return vol.Status.LastRetryTime.Add(backoff).Sub(now)
 }
 
+// removeVolume removes the iscsi target and the lvm lv of the volume, the steps which are not
+// done are skipped because a failed volume may be only partially created
 func (r *VolumeReconciler) removeVolume(ctx context.Context, vol *riov1.Volume) (err error) {
 	// Unmount iscsi device
-	lunStr := fmt.Sprintf("%d", vol.Spec.IscsiLun)
-	_, err = iscsi.UnmountLun(vol.Spec.IscsiTarget, lunStr)
-	if err != nil {
-		logger.StdLog.Error(err)
-		return err
+	if vol.Spec.IscsiLun != -1 {
+		lunStr := fmt.Sprintf("%d", vol.Spec.IscsiLun)
+		_, err = iscsi.UnmountLun(vol.Spec.IscsiTarget, lunStr)
+		if err != nil {
+			logger.StdLog.Error(err)
+			return err
+		}
 	}
 
-	// UnPublish volume
-	_, err = iscsi.UnPublicBlockDevice(vol.Name)
-	if err != nil {
-		logger.StdLog.Error(err)
-		return err
+	// UnPublish volume, ephemeral volume has no iscsi block
+	if !crd.IsEphemeralVolume(vol) {
+		_, err = iscsi.UnPublicBlockDevice(vol.Name)
+		if err != nil {
+			logger.StdLog.Error(err)
+			return err
+		}
 	}
 
 	// remove disk iscsi target
-	err = iscsi.DeleteTarget(vol.Spec.IscsiTarget)
-	if err != nil {
-		logger.StdLog.Error(err)
-		return err
+	if vol.Spec.IscsiTarget != "" {
+		err = iscsi.DeleteTarget(vol.Spec.IscsiTarget)
+		if err != nil {
+			logger.StdLog.Error(err)
+			return err
+		}
 	}
 
 	// remove lvm lv
-	err = lvm.DeleteLVMVolume(vol)
+	if vol.Spec.VolGroup != "" {
+		err = lvm.DeleteLVMVolume(vol)
+	}
 	if err == nil {
 		err = crd.RemoveVolFinalizer(vol)
 	}
@@ -184,7 +254,7 @@ func (r *VolumeReconciler) createVolume(ctx context.Context, vol *riov1.Volume)
 	// if there is already a volGroup field set for lvmvolume resource,
 	// we'll first try to create a volume in that volume group.
 	if vol.Spec.VolGroup != "" {
-		err = lvm.CreateLVMVolume(vol)
+		err = createLVMVolume(vol)
 		if err != nil {
 			logger.StdLog.Errorf("create lvm volume %s error %v", vol.Name, err)
 		}
@@ -199,8 +269,8 @@ func (r *VolumeReconciler) createVolume(ctx context.Context, vol *riov1.Volume)
 		}
 
 		if len(vgs) == 0 {
-			err = fmt.Errorf("no vg available to serve volume request having regex=%q & capacity=%q",
-				vol.Spec.VgPattern, vol.Spec.Capacity)
+			err = fmt.Errorf("%w: no vg available to serve volume request having regex=%q & capacity=%q",
+				errInsufficientCapacity, vol.Spec.VgPattern, vol.Spec.Capacity)
 			logger.StdLog.Errorf("lvm volume %v - %v", vol.Name, err)
 			return
 
@@ -213,7 +283,7 @@ func (r *VolumeReconciler) createVolume(ctx context.Context, vol *riov1.Volume)
 					return err
 				}
 
-				err = lvm.CreateLVMVolume(vol)
+				err = createLVMVolume(vol)
 				if err != nil {
 					// try next vgs to create volume
 					logger.StdLog.Errorf("create lvm volume %s error %v", vol.Name, err)
@@ -223,9 +293,23 @@ func (r *VolumeReconciler) createVolume(ctx context.Context, vol *riov1.Volume)
 				// create lvm volume exist
 				break
 			}
+
+			// lvm.CreateLVMVolume fails for all vgs
+			if err != nil {
+				return err
+			}
 		}
 	}
 
+	// ephemeral volume is only mounted on its owner node, it needs no iscsi target and lun
+	if crd.IsEphemeralVolume(vol) {
+		err = crd.UpdateVolInfoWithStatus(vol, crd.StatusCreated)
+		if err != nil {
+			logger.StdLog.Errorf("UpdateVolInfoWithStatus %s error %v", vol.Name, err)
+		}
+		return err
+	}
+
 	if vol.Spec.IscsiTarget == "" {
 		// create volume target
 		volumeTarget := iscsi.GenerateTargetName("volume", vol.Name)
@@ -244,28 +328,11 @@ func (r *VolumeReconciler) createVolume(ctx context.Context, vol *riov1.Volume)
 		}
 	}
 
-	if err == nil && !vol.Spec.IscsiACLIsSet {
-		// check ACL
-		err = CreateTargetAcl(vol.Namespace, vol.Spec.IscsiTarget, r.IscsiUsername, r.IscsiPassword)
-		if err != nil {
-			logger.StdLog.Error(err, fmt.Sprintf("CreateTargetAcl %v", err))
-			return err
-		}
-
-		vol.Spec.IscsiACLIsSet = true
-		vol, err = crd.UpdateVolume(vol)
-		if err != nil {
-			logger.StdLog.Error(err, fmt.Sprintf("UpdateVolume vol %s error:  %v",
-				vol.Name, err))
-			return err
-		}
-	}
-
 	// Iscsi publish volume
 	if err == nil && vol.Spec.IscsiBlock == "" {
 		device := getVolumeDevice(vol)
 		// TODO check device exist
-		_, err = iscsi.PublicBlockDevice(vol.Name, device)
+		_, err = iscsi.PublicBlockDevice(vol.Name, device, vol.Spec.ReadOnly == lvm.YES)
 		if err != nil {
 			logger.StdLog.Error(err, fmt.Sprintf("PublicBlockDevice target %s, vol %s, device %s error: %v",
 				vol.Spec.IscsiTarget, vol.Name, device, err))
@@ -351,6 +418,16 @@ func (r *VolumeReconciler) cloneFromSource(ctx context.Context, vol *riov1.Volum
 			return err
 		}
 		logger.StdLog.Infof("finish disk %s cloneFromSource", vol.Name)
+	case enums.DataSourceTypeVolume:
+		if vol.Spec.DataSource == "" {
+			break
+		}
+
+		err = r.cloneFromVolume(vol)
+		if err != nil {
+			return err
+		}
+		logger.StdLog.Infof("finish disk %s cloneFromSource", vol.Name)
 	}
 
 	err = crd.UpdateVolInfoWithStatus(vol, crd.StatusReady)
@@ -362,11 +439,150 @@ func (r *VolumeReconciler) cloneFromSource(ctx context.Context, vol *riov1.Volum
 	return nil
 }
 
-func (r *VolumeReconciler) transformLVMError(err error) *riov1.VolumeError {
+// cloneFromVolume copies the data of the source volume into vol, a temporary lvm snapshot
+// of the source is taken so the source can keep serving io while the data is copied
+func (r *VolumeReconciler) cloneFromVolume(vol *riov1.Volume) (err error) {
+	srcVol, err := crd.GetVolume(vol.Spec.DataSource)
+	if err != nil {
+		logger.StdLog.Errorf("get clone source volume %s error %v", vol.Spec.DataSource, err)
+		return err
+	}
+
+	tmpSnap := &riov1.Snapshot{}
+	tmpSnap.Name = getCloneSnapName(vol.Name)
+	tmpSnap.Spec.OwnerNodeID = srcVol.Spec.OwnerNodeID
+	tmpSnap.Spec.VolGroup = srcVol.Spec.VolGroup
+	// reserve the whole source size so the snapshot can't overflow during copying,
+	// thin volume snapshot allocates from its thin pool
+	if srcVol.Spec.ThinProvision != lvm.YES {
+		tmpSnap.Spec.SnapSize = srcVol.Spec.Capacity
+	}
+	crd.WithLabels(tmpSnap, map[string]string{crd.VolKey: srcVol.Name})
+
+	// clean the temporary snapshot left by the former failed clone
+	err = lvm.DestroySnapshot(tmpSnap)
+	if err != nil {
+		logger.StdLog.Errorf("destroy stale clone snapshot %s error %v", tmpSnap.Name, err)
+		return err
+	}
+
+	err = lvm.CreateSnapshot(tmpSnap)
+	if err != nil {
+		logger.StdLog.Errorf("create clone snapshot %s of volume %s error %v", tmpSnap.Name, srcVol.Name, err)
+		return err
+	}
+
+	defer func() {
+		if destroyErr := lvm.DestroySnapshot(tmpSnap); destroyErr != nil {
+			logger.StdLog.Errorf("destroy clone snapshot %s error %v", tmpSnap.Name, destroyErr)
+			if err == nil {
+				err = destroyErr
+			}
+		}
+	}()
+
+	snapshotDevPath := lvm.GetDevPath(tmpSnap.Spec.VolGroup, lvm.GetLVMSnapName(tmpSnap.Name))
+	volumeDevPath := lvm.GetVolumeDevPath(vol)
+	if exist, exErr := lvm.CheckPathExist(snapshotDevPath); !exist {
+		logger.StdLog.Errorf("clone snapshot dev path %s not exist %v", snapshotDevPath, exErr)
+		return fmt.Errorf("clone snapshot dev path %s not exist", snapshotDevPath)
+	}
+
+	if exist, exErr := lvm.CheckPathExist(volumeDevPath); !exist {
+		logger.StdLog.Errorf("volume dev path %s not exist %v", volumeDevPath, exErr)
+		return fmt.Errorf("volume dev path %s not exist", volumeDevPath)
+	}
+
+	logger.StdLog.Infof("disk dump %s to volume %s", snapshotDevPath, volumeDevPath)
+	err = dd.DiskDump(snapshotDevPath, volumeDevPath)
+	if err != nil {
+		logger.StdLog.Errorf("DiskDump error %s and %s: %v", snapshotDevPath, volumeDevPath, err)
+		return err
+	}
+
+	return nil
+}
+
+// getCloneSnapName returns the temporary snapshot name used to clone a volume
+func getCloneSnapName(volName string) string {
+	return "clone-" + volName
+}
+
+// publishVolume makes the target acl only allow the nodes the volume published to,
+// the acl nodes are recorded in status after the acl has been set
+func (r *VolumeReconciler) publishVolume(ctx context.Context, vol *riov1.Volume) (*riov1.Volume, error) {
+	nodeIDs := getAclNodes(vol)
+	err := SyncTargetAcl(vol.Namespace, vol.Spec.IscsiTarget, nodeIDs, r.IscsiUsername, r.IscsiPassword)
+	if err != nil {
+		logger.StdLog.Errorf("SyncTargetAcl volume %s nodes %v error %v", vol.Name, nodeIDs, err)
+		return nil, err
+	}
+
+	// record the acl nodes rather than the published ones, the controller waits on them to
+	// tell whether a node can still access the target
+	if equality.Semantic.DeepEqual(vol.Status.PublishedNodes, nodeIDs) {
+		return vol, nil
+	}
+
+	logger.StdLog.Infof("volume %s published nodes %v acl nodes %v", vol.Name, vol.Spec.PublishedNodes, nodeIDs)
+	vol.Status.PublishedNodes = nodeIDs
+	newVol, err := crd.UpdateVolumeStatus(vol)
+	if err != nil {
+		logger.StdLog.Errorf("UpdateVolumeStatus %s error %v", vol.Name, err)
+		return nil, err
+	}
+
+	return newVol, nil
+}
+
+// expandVolume grows the lvm volume when the requested capacity is larger than
+// the provisioned one. The LUN is backed by the lv block device, so the target
+// exposes the new size as soon as lvextend finishes.
+func (r *VolumeReconciler) expandVolume(ctx context.Context, vol *riov1.Volume) (err error) {
+	if vol.Status.Capacity == vol.Spec.Capacity {
+		// the error of a former failed expansion is stale once the lv has the spec size,
+		// otherwise the volume is reported abnormal forever
+		if vol.Status.Error != nil {
+			vol.Status.Error = nil
+			if _, err = crd.UpdateVolumeStatus(vol); err != nil {
+				logger.StdLog.Errorf("UpdateVolumeStatus %s error %v", vol.Name, err)
+				return err
+			}
+		}
+		return nil
+	}
+
+	logger.StdLog.Infof("expand volume %s from %s to %s", vol.Name, vol.Status.Capacity, vol.Spec.Capacity)
+	err = lvm.ResizeLVMVolume(vol, false)
+	if err != nil {
+		logger.StdLog.Errorf("ResizeLVMVolume %s to %s error %v", vol.Name, vol.Spec.Capacity, err)
+		vol.Status.Error = transformLVMError(err)
+		if _, updateErr := crd.UpdateVolumeStatus(vol); updateErr != nil {
+			logger.StdLog.Errorf("UpdateVolumeStatus %s error %v", vol.Name, updateErr)
+		}
+		return err
+	}
+
+	vol.Status.Capacity = vol.Spec.Capacity
+	vol.Status.Error = nil
+	_, err = crd.UpdateVolumeStatus(vol)
+	if err != nil {
+		logger.StdLog.Errorf("UpdateVolumeStatus %s error %v", vol.Name, err)
+		return err
+	}
+
+	return nil
+}
+
+func transformLVMError(err error) *riov1.VolumeError {
 	volErr := &riov1.VolumeError{
 		Code:    riov1.Internal,
 		Message: err.Error(),
 	}
+	if errors.Is(err, errInsufficientCapacity) {
+		volErr.Code = riov1.InsufficientCapacity
+		return volErr
+	}
 	execErr, ok := err.(*lvm.ExecError)
 	if !ok {
 		return volErr
@@ -379,6 +595,18 @@ func (r *VolumeReconciler) transformLVMError(err error) *riov1.VolumeError {
 	return volErr
 }
 
+// createLVMVolume creates the logical volume, the thin pool of the vg is created at its first thin volume
+func createLVMVolume(vol *riov1.Volume) error {
+	if vol.Spec.ThinProvision == lvm.YES {
+		if err := lvm.CreateThinPool(vol.Spec.VolGroup); err != nil {
+			logger.StdLog.Errorf("create thin pool of vg %s error %v", vol.Spec.VolGroup, err)
+			return err
+		}
+	}
+
+	return lvm.CreateLVMVolume(vol)
+}
+
 // getVgPriorityList returns ordered list of volume groups from higher to lower
 // priority to use for provisioning a lvm volume. As of now, we are prioritizing
 // the vg having least amount free space available to fit the volume.
@@ -403,12 +631,14 @@ func (r *VolumeReconciler) getVgPriorityList(vol *riov1.Volume) ([]riov1.VolumeG
 		if !re.MatchString(vg.Name) {
 			continue
 		}
-		// skip the vgs capacity comparison in case of thin provision enable volume
-		if vol.Spec.ThinProvision != "yes" {
-			// filter vgs having insufficient capacity.
-			if vg.Free.Value() < int64(capacity) {
+		// the thin volume is bounded by the overcommit ratio of the thin pool instead of the vg free space
+		if vol.Spec.ThinProvision == lvm.YES {
+			if lvm.ThinAvailable(vg) < int64(capacity) {
 				continue
 			}
+		} else if vg.Free.Value() < int64(capacity) {
+			// filter vgs having insufficient capacity.
+			continue
 		}
 		filteredVgs = append(filteredVgs, vg)
 	}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/lib/iscsi"
+	"qiniu.io/rio-csi/lib/lvm"
+	"qiniu.io/rio-csi/logger"
+	"time"
+)
+
+// lvHealthMessages is the message of lvm logical volume health status
+var lvHealthMessages = map[int]string{
+	1: "logical volume is partial, some physical volumes are missing",
+	2: "logical volume metadata refresh needed",
+	3: "logical volume mismatches exist",
+}
+
+// StartVolumeHealthCheck checks the health of volumes owned by the node every interval
+func StartVolumeHealthCheck(nodeID string, interval time.Duration) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		<-timer.C
+		CheckVolumeHealth(nodeID)
+		timer.Reset(interval)
+	}
+}
+
+// CheckVolumeHealth checks the logical volume and iscsi target of the ready volumes owned by the node
+// and records the result to the volume status condition
+func CheckVolumeHealth(nodeID string) {
+	lvs, err := lvm.ListLVMLogicalVolume()
+	if err != nil {
+		logger.StdLog.Errorf("CheckVolumeHealth: list logical volumes error %v", err)
+		return
+	}
+
+	lvMap := make(map[string]lvm.LogicalVolume)
+	for _, lv := range lvs {
+		lvMap[lv.FullName] = lv
+	}
+
+	targetDisks, err := iscsi.TargetLunDisks()
+	if err != nil {
+		logger.StdLog.Errorf("CheckVolumeHealth: list target luns error %v", err)
+		return
+	}
+
+	skip := ""
+	limit := int64(100)
+	for {
+		resp, conStr, err := crd.ListNodeVolumes(nodeID, skip, limit)
+		if err != nil {
+			logger.StdLog.Errorf("CheckVolumeHealth: ListVolumes skip %s limit %d error %v", skip, limit, err)
+			return
+		}
+
+		for i := range resp {
+			vol := &resp[i]
+			if vol.Spec.OwnerNodeID != nodeID || vol.Status.State != crd.StatusReady {
+				continue
+			}
+
+			condition := checkVolumeCondition(vol, lvMap, targetDisks)
+			if equality.Semantic.DeepEqual(vol.Status.Condition, condition) {
+				continue
+			}
+
+			if condition.Abnormal {
+				logger.StdLog.Errorf("volume %s is abnormal: %s", vol.Name, condition.Message)
+			}
+
+			vol.Status.Condition = condition
+			if _, err = crd.UpdateVolumeStatus(vol); err != nil {
+				logger.StdLog.Errorf("CheckVolumeHealth: update volume %s condition error %v", vol.Name, err)
+			}
+		}
+
+		if conStr == "" {
+			break
+		}
+
+		skip = conStr
+	}
+}
+
+// checkVolumeCondition checks the volume logical volume health and whether its target and lun exist
+func checkVolumeCondition(vol *apis.Volume, lvMap map[string]lvm.LogicalVolume, targetDisks map[string]map[string]bool) *apis.VolumeCondition {
+	lv, ok := lvMap[vol.Spec.VolGroup+"/"+vol.Name]
+	if !ok {
+		return &apis.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("logical volume %s/%s not found", vol.Spec.VolGroup, vol.Name),
+		}
+	}
+
+	if msg, ok := lvHealthMessages[lv.HealthStatus]; ok {
+		return &apis.VolumeCondition{Abnormal: true, Message: msg}
+	}
+
+	// ephemeral volume has no iscsi target
+	if crd.IsEphemeralVolume(vol) {
+		return &apis.VolumeCondition{Abnormal: false, Message: "volume is healthy"}
+	}
+
+	disks, ok := targetDisks[vol.Spec.IscsiTarget]
+	if vol.Spec.IscsiTarget == "" || !ok {
+		return &apis.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("iscsi target %s not found", vol.Spec.IscsiTarget),
+		}
+	}
+
+	if !disks[vol.Name] {
+		return &apis.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("iscsi lun of volume %s not found in target %s", vol.Name, vol.Spec.IscsiTarget),
+		}
+	}
+
+	return &apis.VolumeCondition{Abnormal: false, Message: "volume is healthy"}
+}
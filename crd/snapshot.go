@@ -2,18 +2,31 @@ package crd
 
 import (
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apis "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/client"
 	"qiniu.io/rio-csi/logger"
+	"time"
 )
 
 // ProvisionSnapshot creates a Snapshot CR
 func ProvisionSnapshot(snap *apis.Snapshot) error {
-	_, err := client.DefaultClient.InternalClientSet.RioV1().Snapshots(RioNamespace).Create(context.Background(), snap, metav1.CreateOptions{})
-	if err == nil {
-		logger.StdLog.Infof("provosioned snapshot %s", snap.Name)
+	result, err := client.DefaultClient.InternalClientSet.RioV1().Snapshots(RioNamespace).Create(context.Background(), snap, metav1.CreateOptions{})
+	if err != nil {
+		return err
 	}
+
+	logger.StdLog.Infof("provosioned snapshot %s", snap.Name)
+	result.Status.State = StatusPending
+	_, err = client.DefaultClient.InternalClientSet.RioV1().Snapshots(RioNamespace).UpdateStatus(context.Background(), result, metav1.UpdateOptions{})
+	// the owner node has already processed the snapshot
+	if k8serror.IsConflict(err) {
+		return nil
+	}
+
 	return err
 }
 
@@ -42,6 +55,25 @@ func GetSnapshotForVolume(volumeID string) (*apis.SnapshotList, error) {
 	return snapList, err
 }
 
+// ListSnapshots fetches at most limit Snapshots start from the skip continue token,
+// only the snapshots of the volume are returned if volumeID is not empty
+func ListSnapshots(volumeID, skip string, limit int64) (snapshots []apis.Snapshot, conStr string, err error) {
+	listOptions := metav1.ListOptions{
+		Continue: skip,
+		Limit:    limit,
+	}
+	if volumeID != "" {
+		listOptions.LabelSelector = VolKey + "=" + volumeID
+	}
+
+	snapList, err := client.DefaultClient.InternalClientSet.RioV1().Snapshots(RioNamespace).List(context.Background(), listOptions)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return snapList.Items, snapList.Continue, nil
+}
+
 // GetSnapshotStatus returns the status of Snapshot
 func GetSnapshotStatus(snapID string) (string, error) {
 	getOptions := metav1.GetOptions{}
@@ -77,15 +109,38 @@ func UpdateSnapInfo(snap *apis.Snapshot, state string) (newSnap *apis.Snapshot,
 		return nil, err
 	}
 
-	// update snap status
-	if newSnap.Status.State != state {
-		newSnap.Status.State = state
-		newSnap, err = client.DefaultClient.InternalClientSet.RioV1().Snapshots(RioNamespace).UpdateStatus(context.Background(), newSnap, metav1.UpdateOptions{})
-	}
+	// update snap status with the creation time, size and error recorded in snap
+	newSnap.Status = snap.Status
+	newSnap.Status.State = state
+	newSnap, err = client.DefaultClient.InternalClientSet.RioV1().Snapshots(RioNamespace).UpdateStatus(context.Background(), newSnap, metav1.UpdateOptions{})
 
 	return
 }
 
+// WaitForSnapshotProcessed waits till the lvm snapshot becomes
+// ready or failed (i.e reaches to terminal state).
+func WaitForSnapshotProcessed(ctx context.Context, snapID string) (*apis.Snapshot, error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+		snap, err := GetSnapshot(snapID)
+		if err != nil {
+			return nil, status.Errorf(codes.Aborted,
+				"lvm: wait failed, not able to get the snapshot %s %s", snapID, err.Error())
+		}
+		if snap.Status.State == StatusReady ||
+			snap.Status.State == StatusFailed {
+			return snap, nil
+		}
+		timer.Reset(1 * time.Second)
+	}
+}
+
 // RemoveSnapFinalizer adds finalizer to Snapshot CR
 func RemoveSnapFinalizer(snap *apis.Snapshot) (newSnap *apis.Snapshot, err error) {
 	snap.Finalizers = nil
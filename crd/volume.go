@@ -47,6 +47,21 @@ const (
 	NodeKey string = "kubernetes.io/nodename"
 	// TopologyKey is supported topology key for the lvm driver
 	TopologyKey string = "rio.csi.io/nodename"
+	// EphemeralKey is the label of the Volume CR created for csi ephemeral inline volume
+	EphemeralKey string = "rio.csi.io/ephemeral"
+	// PVCNameKey is the annotation of the Volume CR to store the name of the pvc it's created for
+	PVCNameKey string = "rio.csi.io/pvc-name"
+	// PVCNamespaceKey is the annotation of the Volume CR to store the namespace of the pvc it's created for
+	PVCNamespaceKey string = "rio.csi.io/pvc-namespace"
+	// LeakProtectionKey is the annotation of the Volume CR whose pv has not been created yet,
+	// the volume is deleted if its pvc is deleted before the pv is created
+	LeakProtectionKey string = "rio.csi.io/leak-protection"
+	// SpreadGroupKey is the pvc annotation of the spread group and the label of the Volume CR in the group
+	SpreadGroupKey string = "rio.csi.io/spread-group"
+	// SpreadModeKey is the pvc annotation of the spread mode, hard or soft
+	SpreadModeKey string = "rio.csi.io/spread-mode"
+	// SpreadTopologyKey is the pvc annotation of the node label of the topology domain to spread across
+	SpreadTopologyKey string = "rio.csi.io/spread-topology-key"
 
 	// StatusPending shows object has not handled yet
 	StatusPending string = "Pending"
@@ -133,14 +148,35 @@ func GetVolume(volumeID string) (*apis.Volume, error) {
 	return vol, err
 }
 
-// ListVolumes fetches the given Volume
+// ListVolumes fetches at most limit Volumes start from the skip continue token,
+// limit 0 means no limit, the returned continue token is empty at the end of the list
 func ListVolumes(skip string, limit int64) (volumes []apis.Volume, conStr string, err error) {
 	listOptions := metav1.ListOptions{
 		Continue: skip,
 		Limit:    limit,
 	}
 	listResp, listErr := client.DefaultClient.InternalClientSet.RioV1().Volumes(RioNamespace).List(context.Background(), listOptions)
-	if err != nil {
+	if listErr != nil {
+		return nil, "", listErr
+	}
+
+	return listResp.Items, listResp.Continue, nil
+}
+
+// IsEphemeralVolume returns whether the volume is created for csi ephemeral inline volume
+func IsEphemeralVolume(vol *apis.Volume) bool {
+	return vol.Labels[EphemeralKey] == "true"
+}
+
+// ListNodeVolumes lists the Volume CRs labeled with the node page by page
+func ListNodeVolumes(nodeID, skip string, limit int64) (volumes []apis.Volume, conStr string, err error) {
+	listOptions := metav1.ListOptions{
+		LabelSelector: NodeKey + "=" + nodeID,
+		Continue:      skip,
+		Limit:         limit,
+	}
+	listResp, listErr := client.DefaultClient.InternalClientSet.RioV1().Volumes(RioNamespace).List(context.Background(), listOptions)
+	if listErr != nil {
 		return nil, "", listErr
 	}
 
@@ -172,6 +208,29 @@ func WaitForVolumeProcessed(ctx context.Context, volumeID string) (*apis.Volume,
 	}
 }
 
+// WaitForVolumeReady waits till the lvm volume becomes ready or failed,
+// unlike WaitForVolumeProcessed it doesn't stop at the created state.
+func WaitForVolumeReady(ctx context.Context, volumeID string) (*apis.Volume, error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+		vol, err := GetVolume(volumeID)
+		if err != nil {
+			return nil, status.Errorf(codes.Aborted,
+				"lvm: wait failed, not able to get the volume %s %s", volumeID, err.Error())
+		}
+		if vol.Status.State == StatusReady || vol.Status.State == StatusFailed {
+			return vol, nil
+		}
+		timer.Reset(1 * time.Second)
+	}
+}
+
 // WaitForVolumeDestroy waits till the lvm volume gets deleted.
 func WaitForVolumeDestroy(ctx context.Context, volumeID string) error {
 	timer := time.NewTimer(0)
@@ -194,6 +253,101 @@ func WaitForVolumeDestroy(ctx context.Context, volumeID string) error {
 	}
 }
 
+// WaitForVolumeResized waits till the owner node has expanded the lvm volume
+// to at least the given size.
+func WaitForVolumeResized(ctx context.Context, volumeID string, size int64) (*apis.Volume, error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+		vol, err := GetVolume(volumeID)
+		if err != nil {
+			return nil, status.Errorf(codes.Aborted,
+				"lvm: resize wait failed, not able to get the volume %s %s", volumeID, err.Error())
+		}
+
+		capacity, _ := strconv.ParseInt(vol.Status.Capacity, 10, 64)
+		if capacity >= size {
+			return vol, nil
+		}
+
+		// the owner node failed to expand the lvm volume
+		if vol.Status.Error != nil {
+			return nil, status.Errorf(codes.Internal,
+				"lvm: resize volume %s failed: %s", volumeID, vol.Status.Error.Message)
+		}
+		timer.Reset(1 * time.Second)
+	}
+}
+
+// WaitForVolumePublished waits till the owner node has set the target acl for the node
+// published or unpublished
+func WaitForVolumePublished(ctx context.Context, volumeID, nodeID string, published bool) (*apis.Volume, error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+		vol, err := GetVolume(volumeID)
+		if err != nil {
+			if !published && k8serror.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, status.Errorf(codes.Aborted,
+				"lvm: publish wait failed, not able to get the volume %s %s", volumeID, err.Error())
+		}
+
+		if containsNode(vol.Status.PublishedNodes, nodeID) == published {
+			return vol, nil
+		}
+		timer.Reset(1 * time.Second)
+	}
+}
+
+// PublishVolume adds the node to the volume published nodes
+func PublishVolume(vol *apis.Volume, nodeID string) (*apis.Volume, error) {
+	if containsNode(vol.Spec.PublishedNodes, nodeID) {
+		return vol, nil
+	}
+
+	vol.Spec.PublishedNodes = append(vol.Spec.PublishedNodes, nodeID)
+	return UpdateVolume(vol)
+}
+
+// UnpublishVolume removes the node from the volume published nodes
+func UnpublishVolume(vol *apis.Volume, nodeID string) (*apis.Volume, error) {
+	if !containsNode(vol.Spec.PublishedNodes, nodeID) {
+		return vol, nil
+	}
+
+	nodes := make([]string, 0, len(vol.Spec.PublishedNodes))
+	for _, v := range vol.Spec.PublishedNodes {
+		if v != nodeID {
+			nodes = append(nodes, v)
+		}
+	}
+
+	vol.Spec.PublishedNodes = nodes
+	return UpdateVolume(vol)
+}
+
+func containsNode(nodes []string, nodeID string) bool {
+	for _, v := range nodes {
+		if v == nodeID {
+			return true
+		}
+	}
+
+	return false
+}
+
 // GetVolumeState returns Volume OwnerNode and State for
 // the given volume. CreateLVMVolume request may call it again and
 // again until volume is "Ready".
@@ -216,7 +370,9 @@ func UpdateVolInfoWithStatus(vol *apis.Volume, state string) error {
 	var finalizers []string
 	labels := map[string]string{NodeKey: NodeID}
 	switch state {
-	case StatusReady:
+	// failed volume keeps the finalizer so that its partially created resources
+	// are cleaned by the owner node when it's deleted
+	case StatusReady, StatusFailed:
 		finalizers = append(finalizers, RioFinalizer)
 	}
 
@@ -235,6 +391,12 @@ func UpdateVolInfoWithStatus(vol *apis.Volume, state string) error {
 	}
 
 	newVol.Status.State = state
+	// the errors of the failed attempts are resolved once the volume is provisioned
+	if state == StatusCreated || state == StatusReady {
+		newVol.Status.Error = nil
+		newVol.Status.Retries = 0
+		newVol.Status.LastRetryTime = nil
+	}
 	_, err = client.DefaultClient.InternalClientSet.RioV1().Volumes(RioNamespace).UpdateStatus(context.Background(), newVol, metav1.UpdateOptions{})
 
 	return err
@@ -264,11 +426,19 @@ func RemoveVolFinalizer(vol *apis.Volume) error {
 	return err
 }
 
-// ResizeVolume resizes the lvm volume
-func ResizeVolume(vol *apis.Volume, newSize int64) error {
+// ResizeVolume resizes the lvm volume, the error of the last failed expansion is cleared
+// so that it's not taken as the result of this one
+func ResizeVolume(vol *apis.Volume, newSize int64) (err error) {
+	if vol.Status.Error != nil {
+		vol.Status.Error = nil
+		vol, err = UpdateVolumeStatus(vol)
+		if err != nil {
+			return err
+		}
+	}
 
 	vol.Spec.Capacity = strconv.FormatInt(int64(newSize), 10)
 
-	_, err := client.DefaultClient.InternalClientSet.RioV1().Volumes(RioNamespace).Update(context.Background(), vol, metav1.UpdateOptions{})
+	_, err = client.DefaultClient.InternalClientSet.RioV1().Volumes(RioNamespace).Update(context.Background(), vol, metav1.UpdateOptions{})
 	return err
 }
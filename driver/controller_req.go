@@ -5,10 +5,20 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/lib/lvm"
 	"qiniu.io/rio-csi/lib/lvm/common/errors"
 	"strings"
 )
 
+// supportedFsTypes is the filesystems can be used on volumes, empty means the default ext4
+var supportedFsTypes = map[string]bool{
+	"":      true,
+	"ext4":  true,
+	"xfs":   true,
+	"btrfs": true,
+}
+
 // validateRequest validates if the requested service is
 // supported by the driver
 func (cs *ControllerServer) validateRequest(c csi.ControllerServiceCapability_RPC_Type) error {
@@ -55,7 +65,7 @@ func (cs *ControllerServer) validateVolumeCreateReq(req *csi.CreateVolumeRequest
 		// VolumeCapabilities will contain volume mode
 		if mode := volCap.GetAccessMode(); mode != nil {
 			inputMode := mode.GetMode()
-			// At the moment we only support SINGLE_NODE_WRITER i.e Read-Write-Once
+			// the access modes are enforced by node publish volume
 			var isModeSupported bool
 			for _, supporteVolCapability := range cs.Driver.accessModes {
 				if inputMode == supporteVolCapability.Mode {
@@ -66,7 +76,7 @@ func (cs *ControllerServer) validateVolumeCreateReq(req *csi.CreateVolumeRequest
 
 			if !isModeSupported {
 				return status.Errorf(codes.InvalidArgument,
-					"only ReadwriteOnce access mode is supported",
+					"access mode %s is not supported", inputMode,
 				)
 			}
 		}
@@ -134,3 +144,196 @@ func (cs *ControllerServer) validateDeleteVolumeReq(req *csi.DeleteVolumeRequest
 	}
 	return nil
 }
+
+func (cs *ControllerServer) validateVolumeExpandReq(req *csi.ControllerExpandVolumeRequest) error {
+	err := cs.validateRequest(
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+	)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"failed to handle expand volume request for {%s}",
+			req.GetVolumeId(),
+		)
+	}
+
+	if req.GetVolumeId() == "" {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle expand volume request: missing volume id",
+		)
+	}
+
+	if req.GetCapacityRange() == nil {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle expand volume request: missing capacity range",
+		)
+	}
+
+	return nil
+}
+
+func (cs *ControllerServer) validateListVolumesReq(req *csi.ListVolumesRequest) error {
+	err := cs.validateRequest(
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+	)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"failed to handle list volumes request",
+		)
+	}
+
+	if req.GetMaxEntries() < 0 {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"failed to handle list volumes request: invalid max entries %d",
+			req.GetMaxEntries(),
+		)
+	}
+
+	return nil
+}
+
+func (cs *ControllerServer) validateListSnapshotsReq(req *csi.ListSnapshotsRequest) error {
+	err := cs.validateRequest(
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+	)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"failed to handle list snapshots request",
+		)
+	}
+
+	if req.GetMaxEntries() < 0 {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"failed to handle list snapshots request: invalid max entries %d",
+			req.GetMaxEntries(),
+		)
+	}
+
+	return nil
+}
+
+func (cs *ControllerServer) validateVolumeCapabilitiesReq(req *csi.ValidateVolumeCapabilitiesRequest) error {
+	if req.GetVolumeId() == "" {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle validate volume capabilities request: missing volume id",
+		)
+	}
+
+	if len(req.GetVolumeCapabilities()) == 0 {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle validate volume capabilities request: missing volume capabilities",
+		)
+	}
+
+	return nil
+}
+
+// checkVolumeCapability returns the reason why the volume capability is not supported,
+// empty string means it's supported
+func (cs *ControllerServer) checkVolumeCapability(vol *apis.Volume, volCap *csi.VolumeCapability) string {
+	mode := volCap.GetAccessMode().GetMode()
+	isModeSupported := false
+	for _, supportedMode := range cs.Driver.accessModes {
+		if mode == supportedMode.Mode {
+			isModeSupported = true
+			break
+		}
+	}
+
+	if !isModeSupported {
+		return fmt.Sprintf("access mode %s is not supported", mode)
+	}
+
+	// read only volume is write-protected in its iscsi target
+	if vol.Spec.ReadOnly == lvm.YES && !isReadOnlyAccessMode(mode) {
+		return fmt.Sprintf("access mode %s is not supported, volume %s is read only", mode, vol.Name)
+	}
+
+	// the volume can be written from many nodes only if it's shared, the pods
+	// on the same node share its single iscsi session
+	switch mode {
+	case csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER:
+		if vol.Spec.Shared != lvm.YES {
+			return fmt.Sprintf("access mode %s requires a shared volume, volume %s is not shared", mode, vol.Name)
+		}
+	}
+
+	switch accessType := volCap.GetAccessType().(type) {
+	case *csi.VolumeCapability_Block:
+	case *csi.VolumeCapability_Mount:
+		if fsType := accessType.Mount.GetFsType(); !supportedFsTypes[fsType] {
+			return fmt.Sprintf("fs type %s is not supported, only ext4, xfs and btrfs are supported", fsType)
+		}
+	default:
+		return "only Block mode (or) FileSystem mode is supported"
+	}
+
+	return ""
+}
+
+func (cs *ControllerServer) validateControllerPublishReq(req *csi.ControllerPublishVolumeRequest) error {
+	err := cs.validateRequest(
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+	)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"failed to handle publish volume request for {%s}",
+			req.GetVolumeId(),
+		)
+	}
+
+	if req.GetVolumeId() == "" {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle publish volume request: missing volume id",
+		)
+	}
+
+	if req.GetNodeId() == "" {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle publish volume request: missing node id",
+		)
+	}
+
+	if req.GetVolumeCapability() == nil {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle publish volume request: missing volume capability",
+		)
+	}
+
+	return nil
+}
+
+func (cs *ControllerServer) validateControllerUnpublishReq(req *csi.ControllerUnpublishVolumeRequest) error {
+	err := cs.validateRequest(
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+	)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"failed to handle unpublish volume request for {%s}",
+			req.GetVolumeId(),
+		)
+	}
+
+	if req.GetVolumeId() == "" {
+		return status.Error(
+			codes.InvalidArgument,
+			"failed to handle unpublish volume request: missing volume id",
+		)
+	}
+
+	return nil
+}
@@ -1,18 +1,23 @@
 package driver
 
 import (
+	stderrors "errors"
+	"fmt"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/mount"
 	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/client"
 	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/driver/dparams"
 	"qiniu.io/rio-csi/driver/scheduler"
 	"qiniu.io/rio-csi/enums"
+	"qiniu.io/rio-csi/lib/lvm"
 	"qiniu.io/rio-csi/lib/lvm/builder/volbuilder"
 	"qiniu.io/rio-csi/lib/lvm/common/errors"
 	"qiniu.io/rio-csi/logger"
@@ -21,6 +26,13 @@ import (
 	"strings"
 )
 
+// publish context keys of the volume iscsi target
+const (
+	PublishContextPortal    = "portal"
+	PublishContextTargetIqn = "targetIqn"
+	PublishContextLun       = "lun"
+)
+
 type ControllerServer struct {
 	Driver *RioCSI
 	// Users add fields as needed.
@@ -61,6 +73,15 @@ func (cs *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		existVol, err = nil, nil
 	}
 
+	// the failed volume is deleted and rescheduled
+	if existVol != nil && existVol.Status.State == crd.StatusFailed {
+		return nil, failedVolumeError(existVol)
+	}
+
+	if existVol != nil && existVol.GetDeletionTimestamp() != nil {
+		return nil, status.Errorf(codes.Aborted, "volume %s is being deleted", volName)
+	}
+
 	// if exist return success
 	if existVol != nil {
 		topology := map[string]string{crd.TopologyKey: existVol.Spec.OwnerNodeID}
@@ -78,49 +99,108 @@ func (cs *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}, nil
 	}
 
-	node, err := cs.schedulerManager.ScheduleVolume(req, params)
+	// volume with content source must be created at the node and vg of the source
+	// because the data is copied through a local lvm snapshot
+	var dataSource, sourceNode, sourceVg string
+	var dataSourceType enums.DataSourceType
+	if volumeSource != nil {
+		switch volumeSource.Type.(type) {
+		case *csi.VolumeContentSource_Snapshot:
+			snapshotID := volumeSource.GetSnapshot().GetSnapshotId()
+			snap, err := crd.GetSnapshot(snapshotID)
+			if err != nil {
+				if k8serror.IsNotFound(err) {
+					return nil, status.Errorf(codes.NotFound, "source snapshot %s not found", snapshotID)
+				}
+				return nil, status.Errorf(codes.Internal, "get source snapshot %s error %v", snapshotID, err)
+			}
+
+			dataSource, dataSourceType = snapshotID, enums.DataSourceTypeSnapshot
+			sourceNode, sourceVg = snap.Spec.OwnerNodeID, snap.Spec.VolGroup
+		case *csi.VolumeContentSource_Volume:
+			sourceVolumeID := volumeSource.GetVolume().GetVolumeId()
+			sourceVol, err := crd.GetVolume(sourceVolumeID)
+			if err != nil {
+				if k8serror.IsNotFound(err) {
+					return nil, status.Errorf(codes.NotFound, "source volume %s not found", sourceVolumeID)
+				}
+				return nil, status.Errorf(codes.Internal, "get source volume %s error %v", sourceVolumeID, err)
+			}
+
+			if sourceVol.Status.State != crd.StatusReady {
+				return nil, status.Errorf(codes.Unavailable, "source volume %s is %s not ready", sourceVolumeID, sourceVol.Status.State)
+			}
+
+			sourceSize, _ := strconv.ParseInt(sourceVol.Spec.Capacity, 10, 64)
+			if size < sourceSize {
+				return nil, status.Errorf(codes.OutOfRange,
+					"volume size %d is smaller than source volume %s size %d", size, sourceVolumeID, sourceSize)
+			}
+
+			dataSource, dataSourceType = sourceVolumeID, enums.DataSourceTypeVolume
+			sourceNode, sourceVg = sourceVol.Spec.OwnerNodeID, sourceVol.Spec.VolGroup
+		}
+	}
+
+	if err = applyPVCSpreadAnnotations(ctx, params); err != nil {
+		return nil, err
+	}
+
+	node, vg, err := cs.schedulerManager.ScheduleVolume(req, params, sourceNode, sourceVg)
 	if err != nil {
 		logger.StdLog.Errorf("ScheduleVolume %s vgPattern %s with error %v", volName, params.VgPattern.String(), err)
+		switch {
+		case stderrors.Is(err, scheduler.ErrNoSuitableNode):
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		case stderrors.Is(err, scheduler.ErrSourceNodeUnfit):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	logger.StdLog.Info("scheduler volume", volName, "on node", node)
+	logger.StdLog.Infof("scheduler volume %s on node %s vg %s", volName, node, vg)
+
+	readOnly := "no"
+	if isReadOnlyVolume(req.GetVolumeCapabilities()) {
+		readOnly = lvm.YES
+	}
 
 	newVol, buildErr := volbuilder.NewBuilder().
 		WithName(volName).
 		WithCapacity(capacity).
 		WithVgPattern(params.VgPattern.String()).
 		WithOwnerNode(node).
+		WithVolGroup(vg).
 		WithVolumeStatus(crd.StatusPending).
 		WithShared(params.Shared).
-		WithThinProvision(params.ThinProvision).Build()
-	// set default iscsi lun is -1 means no lun device
-	newVol.Spec.IscsiLun = -1
-
+		WithReadOnly(readOnly).
+		WithThinProvision(params.ThinProvision).
+		WithLabels(spreadGroupLabels(params)).
+		WithAnnotations(leakProtectionAnnotations(params)).Build()
 	if buildErr != nil {
+		cs.schedulerManager.UnscheduleVolume(volName)
 		return nil, status.Error(codes.Internal, buildErr.Error())
 	}
 
-	cntx := map[string]string{crd.VolGroupKey: newVol.Spec.VolGroup}
+	// set default iscsi lun is -1 means no lun device
+	newVol.Spec.IscsiLun = -1
 
-	if volumeSource != nil {
-		switch volumeSource.Type.(type) {
-		case *csi.VolumeContentSource_Snapshot:
-			if snapshot := volumeSource.GetSnapshot(); snapshot != nil {
-				cntx["dataSource"] = snapshot.SnapshotId
-				newVol.Spec.DataSource = snapshot.SnapshotId
-				newVol.Spec.DataSourceType = enums.DataSourceTypeSnapshot
-			}
-		case *csi.VolumeContentSource_Volume:
-			return nil, status.Error(codes.Unimplemented, "")
-		}
+	if dataSource != "" {
+		newVol.Spec.DataSource = dataSource
+		newVol.Spec.DataSourceType = dataSourceType
 	}
 
-	// TODO mark volume for leak protection if pvc gets deleted
-	// before the creation of pv.
+	cntx := map[string]string{crd.VolGroupKey: newVol.Spec.VolGroup}
+	if dataSource != "" {
+		cntx["dataSource"] = dataSource
+	}
 
 	newVol, err = crd.ProvisionVolume(newVol)
 	if err != nil {
+		// the reservation is leaked if the volume CR is not created
+		if !k8serror.IsAlreadyExists(err) {
+			cs.schedulerManager.UnscheduleVolume(volName)
+		}
 		return nil, status.Errorf(codes.Internal, "not able to provision the volume %s", err.Error())
 	}
 
@@ -131,6 +211,10 @@ func (cs *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 	}
 
+	if newVol.Status.State == crd.StatusFailed {
+		return nil, failedVolumeError(newVol)
+	}
+
 	//
 	topology := map[string]string{crd.TopologyKey: newVol.Spec.OwnerNodeID}
 	return &csi.CreateVolumeResponse{
@@ -147,6 +231,24 @@ func (cs *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	}, nil
 }
 
+// failedVolumeError deletes the volume failed on its owner node and returns ResourceExhausted,
+// so that external-provisioner reschedules the pvc and the volume is placed on another node
+func failedVolumeError(vol *apis.Volume) error {
+	msg := "unknown error"
+	if vol.Status.Error != nil {
+		msg = fmt.Sprintf("%s: %s", vol.Status.Error.Code, vol.Status.Error.Message)
+	}
+
+	if vol.GetDeletionTimestamp() == nil {
+		if err := crd.DeleteVolume(vol.Name); err != nil && !k8serror.IsNotFound(err) {
+			logger.StdLog.Errorf("delete failed volume %s error %v", vol.Name, err)
+		}
+	}
+
+	return status.Errorf(codes.ResourceExhausted, "volume %s failed to provision on node %s: %s",
+		vol.Name, vol.Spec.OwnerNodeID, msg)
+}
+
 func (cs *ControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 	logger.StdLog.Debugf("running DeleteVolume...")
 	var err error
@@ -181,29 +283,194 @@ func (cs *ControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
-func (cs *ControllerServer) ControllerPublishVolume(_ context.Context, _ *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	logger.StdLog.Debugf("running ControllerPublishVolume...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented ControllerPublishVolume")
+// ControllerPublishVolume allows the node initiator to log in the volume target, the acl is
+// set by the owner node through the volume published nodes
+func (cs *ControllerServer) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	logger.StdLog.Infof("received request to publish volume %s to node %s", req.GetVolumeId(), req.GetNodeId())
+	if err := cs.validateControllerPublishReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	nodeID := req.GetNodeId()
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "failed get volume %s: %v", volumeID, err)
+	}
+
+	if _, err = client.DefaultClient.InternalClientSet.RioV1().RioNodes(crd.RioNamespace).Get(ctx, nodeID, metav1.GetOptions{}); err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "node %s not found", nodeID)
+		}
+		return nil, status.Errorf(codes.Internal, "failed get node %s: %v", nodeID, err)
+	}
+
+	ownerNode, err := client.DefaultClient.InternalClientSet.RioV1().RioNodes(crd.RioNamespace).Get(ctx, vol.Spec.OwnerNodeID, metav1.GetOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed get volume %s owner node %s: %v", volumeID, vol.Spec.OwnerNodeID, err)
+	}
+
+	if _, err = crd.PublishVolume(vol, nodeID); err != nil {
+		logger.StdLog.Errorf("PublishVolume %s to node %s error %v", volumeID, nodeID, err)
+		return nil, status.Errorf(codes.Internal, "failed to publish volume %s to node %s: %v", volumeID, nodeID, err)
+	}
+
+	if vol, err = crd.WaitForVolumePublished(ctx, volumeID, nodeID, true); err != nil {
+		return nil, err
+	}
+
+	return &csi.ControllerPublishVolumeResponse{
+		PublishContext: map[string]string{
+			PublishContextPortal:    ownerNode.ISCSIInfo.Portal,
+			PublishContextTargetIqn: vol.Spec.IscsiTarget,
+			PublishContextLun:       strconv.FormatInt(int64(vol.Spec.IscsiLun), 10),
+		},
+	}, nil
 }
 
-func (cs *ControllerServer) ControllerUnpublishVolume(_ context.Context, _ *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	logger.StdLog.Debugf("running ControllerUnpublishVolume...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented ControllerUnpublishVolume")
+// ControllerUnpublishVolume removes the node initiator from the volume target acl
+func (cs *ControllerServer) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	logger.StdLog.Infof("received request to unpublish volume %s from node %s", req.GetVolumeId(), req.GetNodeId())
+	if err := cs.validateControllerUnpublishReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	nodeID := req.GetNodeId()
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
+		return nil, status.Errorf(codes.Internal, "failed get volume %s: %v", volumeID, err)
+	}
+
+	// empty node id means unpublish from all nodes
+	nodeIDs := []string{nodeID}
+	if nodeID == "" {
+		nodeIDs = vol.Spec.PublishedNodes
+	}
+
+	for _, id := range nodeIDs {
+		if vol, err = crd.UnpublishVolume(vol, id); err != nil {
+			logger.StdLog.Errorf("UnpublishVolume %s from node %s error %v", volumeID, id, err)
+			return nil, status.Errorf(codes.Internal, "failed to unpublish volume %s from node %s: %v", volumeID, id, err)
+		}
+	}
+
+	for _, id := range nodeIDs {
+		if _, err = crd.WaitForVolumePublished(ctx, volumeID, id, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
 
-func (cs *ControllerServer) ValidateVolumeCapabilities(_ context.Context, _ *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+// ValidateVolumeCapabilities confirms the capabilities only when the access modes, the shared flag
+// of the volume, the access types and the fs types are all supported
+func (cs *ControllerServer) ValidateVolumeCapabilities(_ context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
 	logger.StdLog.Debugf("running ValidateVolumeCapabilities...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented ValidateVolumeCapabilities")
+	if err := cs.validateVolumeCapabilitiesReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "failed get volume %s: %v", volumeID, err)
+	}
+
+	for _, volCap := range req.GetVolumeCapabilities() {
+		if msg := cs.checkVolumeCapability(vol, volCap); msg != "" {
+			logger.StdLog.Infof("volume %s capability %v is not confirmed: %s", volumeID, volCap, msg)
+			return &csi.ValidateVolumeCapabilitiesResponse{Message: msg}, nil
+		}
+	}
+
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.GetVolumeContext(),
+			VolumeCapabilities: req.GetVolumeCapabilities(),
+			Parameters:         req.GetParameters(),
+		},
+	}, nil
 }
 
-func (cs *ControllerServer) ListVolumes(_ context.Context, _ *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+// ListVolumes lists the Volume CRs page by page, the starting token is the kubernetes
+// list continue token
+func (cs *ControllerServer) ListVolumes(_ context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
 	logger.StdLog.Debugf("running ListVolumes...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented ListVolumes")
+	if err := cs.validateListVolumesReq(req); err != nil {
+		return nil, err
+	}
+
+	volumes, nextToken, err := crd.ListVolumes(req.GetStartingToken(), int64(req.GetMaxEntries()))
+	if err != nil {
+		// the continue token is invalid or expired
+		if k8serror.IsResourceExpired(err) || k8serror.IsGone(err) || k8serror.IsBadRequest(err) {
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %s: %v", req.GetStartingToken(), err)
+		}
+		logger.StdLog.Errorf("ListVolumes token %s max entries %d error %v", req.GetStartingToken(), req.GetMaxEntries(), err)
+		return nil, status.Errorf(codes.Internal, "failed to list volumes: %v", err)
+	}
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, len(volumes))
+	for i := range volumes {
+		vol := &volumes[i]
+		capacity, _ := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      vol.Name,
+				CapacityBytes: capacity,
+				AccessibleTopology: []*csi.Topology{{
+					Segments: map[string]string{crd.TopologyKey: vol.Spec.OwnerNodeID},
+				},
+				},
+				VolumeContext: map[string]string{crd.VolGroupKey: vol.Spec.VolGroup},
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: getPublishedNodeIDs(vol),
+				VolumeCondition:  getVolumeCondition(vol),
+			},
+		})
+	}
+
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
 }
 
-func (cs *ControllerServer) GetCapacity(_ context.Context, _ *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+// GetCapacity reports the free size of the vgs match the storage class vgpattern
+// on the nodes of the requested topology segment after the pending reservations
+func (cs *ControllerServer) GetCapacity(_ context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
 	logger.StdLog.Debugf("running GetCapacity...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented GetCapacity")
+	if err := cs.validateRequest(csi.ControllerServiceCapability_RPC_GET_CAPACITY); err != nil {
+		return nil, err
+	}
+
+	params, err := dparams.NewVolumeParams(req.GetParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"failed to parse csi volume params: %v", err)
+	}
+
+	available, maximum, err := cs.schedulerManager.GetCapacity(params, req.GetAccessibleTopology())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get capacity: %v", err)
+	}
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: available,
+		MaximumVolumeSize: wrapperspb.Int64(maximum),
+	}, nil
 }
 
 // ControllerGetCapabilities implements the default GRPC callout.
@@ -229,63 +496,100 @@ func (cs *ControllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 	}
 
 	if snap != nil {
-		logger.StdLog.Errorf("snapshot %s already present", snapshotName)
-		return &csi.CreateSnapshotResponse{
-			Snapshot: &csi.Snapshot{
-				SnapshotId:     snap.Name,
-				SourceVolumeId: req.SourceVolumeId,
-			},
-		}, nil
-	}
+		logger.StdLog.Infof("snapshot %s already present", snapshotName)
+		if snap.Labels[crd.VolKey] != req.SourceVolumeId {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"snapshot %s already exists for volume %s", snapshotName, snap.Labels[crd.VolKey])
+		}
 
-	snapshot := &apis.Snapshot{}
+		if snap.GetDeletionTimestamp() != nil {
+			return nil, status.Errorf(codes.Aborted, "snapshot %s is being deleted", snapshotName)
+		}
 
-	vol, err := crd.GetVolume(req.SourceVolumeId)
-	if err != nil {
-		logger.StdLog.Error(err)
-		return nil, err
-	}
+		// the failed snapshot is kept for inspection till the retry, remove it so it's created again
+		if snap.Status.State == crd.StatusFailed {
+			if err = crd.DeleteSnapshot(snapshotName); err != nil && !k8serror.IsNotFound(err) {
+				logger.StdLog.Errorf("delete failed snapshot %s error %v", snapshotName, err)
+			}
+			return nil, failedSnapshotError(snap)
+		}
+	} else {
+		params, err := dparams.NewSnapshotParams(req.GetParameters())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to parse csi snapshot params: %v", err)
+		}
 
-	sizeBytes, err := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
-	if err != nil {
-		logger.StdLog.Errorf("cant parse vol %s capacity %s", vol.Name, vol.Spec.Capacity)
-		return nil, err
-	}
+		vol, err := crd.GetVolume(req.SourceVolumeId)
+		if err != nil {
+			logger.StdLog.Error(err)
+			return nil, err
+		}
 
-	// TODO control snapshot snapshot size
-	snapshot.Spec.SnapSize = vol.Spec.Capacity
-	snapshot.Spec.VolGroup = vol.Spec.VolGroup
-	snapshot.Spec.VolGroup = vol.Spec.VolGroup
-	snapshot.Spec.OwnerNodeID = vol.Spec.OwnerNodeID
-	snapshot.Name = snapshotName
+		snap = &apis.Snapshot{}
+		// thin snapshot is allocated from the thin pool and takes no snap size,
+		// otherwise reserve the cow space configured in the volume snapshot class
+		if vol.Spec.ThinProvision != lvm.YES {
+			capacity, err := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "cant parse vol %s capacity %s", vol.Name, vol.Spec.Capacity)
+			}
 
-	labels := map[string]string{
-		crd.VolKey: vol.Name,
-	}
+			snap.Spec.SnapSize = strconv.FormatInt(params.GetSnapSize(capacity), 10)
+		}
+		snap.Spec.VolGroup = vol.Spec.VolGroup
+		snap.Spec.VgPattern = vol.Spec.VgPattern
+		snap.Spec.OwnerNodeID = vol.Spec.OwnerNodeID
+		snap.Name = snapshotName
+
+		labels := map[string]string{
+			crd.VolKey: vol.Name,
+		}
+
+		crd.WithLabels(snap, labels)
+
+		if err = cs.schedulerManager.ScheduleSnapshot(snap); err != nil {
+			logger.StdLog.Errorf("schedule snapshot %s error %v", snapshotName, err)
+			return nil, status.Errorf(codes.ResourceExhausted, "cant reserve snapshot %s: %v", snapshotName, err)
+		}
 
-	crd.WithLabels(snapshot, labels)
+		err = crd.ProvisionSnapshot(snap)
+		if err != nil {
+			logger.StdLog.Error(err)
+			cs.schedulerManager.UnscheduleSnapshot(snapshotName)
+			return nil, err
+		}
+	}
 
-	err = crd.ProvisionSnapshot(snapshot)
+	// wait the owner node create the lvm snapshot
+	snap, err = crd.WaitForSnapshotProcessed(ctx, snapshotName)
 	if err != nil {
-		logger.StdLog.Error(err)
 		return nil, err
 	}
 
-	// TODO ready to use vsc when snapshot is ready
+	// the failed snapshot is kept so its error can be inspected, DeleteSnapshot or the retry removes it
+	if snap.Status.State == crd.StatusFailed {
+		return nil, failedSnapshotError(snap)
+	}
+
 	return &csi.CreateSnapshotResponse{
-		Snapshot: &csi.Snapshot{
-			SizeBytes:      sizeBytes,
-			SnapshotId:     snapshot.Name,
-			SourceVolumeId: req.SourceVolumeId,
-			CreationTime:   timestamppb.Now(),
-			ReadyToUse:     true,
-		},
+		Snapshot: buildCSISnapshot(snap),
 	}, nil
 }
 
+// failedSnapshotError returns the error of the failed snapshot recorded by its owner node
+func failedSnapshotError(snap *apis.Snapshot) error {
+	msg := "unknown error"
+	if snap.Status.Error != nil {
+		msg = fmt.Sprintf("%s: %s", snap.Status.Error.Code, snap.Status.Error.Message)
+	}
+
+	return status.Errorf(codes.Internal, "snapshot %s failed to create on node %s: %s",
+		snap.Name, snap.Spec.OwnerNodeID, msg)
+}
+
 func (cs *ControllerServer) DeleteSnapshot(_ context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
 	snapshotID := strings.ToLower(req.GetSnapshotId())
-	logger.StdLog.Infof("received request to delete snapshot", snapshotID)
+	logger.StdLog.Infof("received request to delete snapshot %s", snapshotID)
 
 	snapshot, err := crd.GetSnapshot(snapshotID)
 	if err != nil {
@@ -311,17 +615,143 @@ func (cs *ControllerServer) DeleteSnapshot(_ context.Context, req *csi.DeleteSna
 	return &csi.DeleteSnapshotResponse{}, nil
 }
 
-func (cs *ControllerServer) ListSnapshots(_ context.Context, _ *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+// ListSnapshots lists the Snapshot CRs filtered by snapshot id or source volume id,
+// the starting token is the kubernetes list continue token
+func (cs *ControllerServer) ListSnapshots(_ context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
 	logger.StdLog.Debugf("running ListSnapshots...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented ListSnapshots")
+	if err := cs.validateListSnapshotsReq(req); err != nil {
+		return nil, err
+	}
+
+	sourceVolumeID := strings.ToLower(req.GetSourceVolumeId())
+
+	// a single snapshot is listed, no pagination is needed
+	if snapshotID := strings.ToLower(req.GetSnapshotId()); snapshotID != "" {
+		snap, err := crd.GetSnapshot(snapshotID)
+		if err != nil {
+			if k8serror.IsNotFound(err) {
+				return &csi.ListSnapshotsResponse{}, nil
+			}
+			logger.StdLog.Errorf("GetSnapshot %s error %v", snapshotID, err)
+			return nil, status.Errorf(codes.Internal, "failed to get snapshot %s: %v", snapshotID, err)
+		}
+
+		if sourceVolumeID != "" && snap.Labels[crd.VolKey] != sourceVolumeID {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+
+		return &csi.ListSnapshotsResponse{
+			Entries: []*csi.ListSnapshotsResponse_Entry{{Snapshot: buildCSISnapshot(snap)}},
+		}, nil
+	}
+
+	snapshots, nextToken, err := crd.ListSnapshots(sourceVolumeID, req.GetStartingToken(), int64(req.GetMaxEntries()))
+	if err != nil {
+		// the continue token is invalid or expired
+		if k8serror.IsResourceExpired(err) || k8serror.IsGone(err) || k8serror.IsBadRequest(err) {
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %s: %v", req.GetStartingToken(), err)
+		}
+		logger.StdLog.Errorf("ListSnapshots volume %s token %s error %v", sourceVolumeID, req.GetStartingToken(), err)
+		return nil, status.Errorf(codes.Internal, "failed to list snapshots: %v", err)
+	}
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, len(snapshots))
+	for i := range snapshots {
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: buildCSISnapshot(&snapshots[i]),
+		})
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
 }
 
-func (cs *ControllerServer) ControllerExpandVolume(_ context.Context, _ *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	logger.StdLog.Debugf("running ControllerExpandVolume...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented ControllerExpandVolume")
+// ControllerExpandVolume grows the volume lv on its owner node through the volume
+// reconciler, the consumer nodes pick up the new size in NodeExpandVolume
+func (cs *ControllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	logger.StdLog.Infof("received request to expand volume %s", req.GetVolumeId())
+	if err := cs.validateVolumeExpandReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "failed get volume %s: %v", volumeID, err)
+	}
+
+	size := utils.GetRoundedCapacity(req.GetCapacityRange().GetRequiredBytes())
+	if limit := req.GetCapacityRange().GetLimitBytes(); limit > 0 && size > limit {
+		return nil, status.Errorf(codes.OutOfRange,
+			"rounded capacity %d of volume %s exceeds limit %d", size, volumeID, limit)
+	}
+
+	curSize, err := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cant parse vol %s capacity %s", vol.Name, vol.Spec.Capacity)
+	}
+
+	// volume is never shrunk, an already expanded volume only waits for the owner node
+	if curSize < size {
+		if err = crd.ResizeVolume(vol, size); err != nil {
+			logger.StdLog.Errorf("ResizeVolume %s to %d error %v", volumeID, size, err)
+			return nil, status.Errorf(codes.Internal, "failed to resize volume %s: %v", volumeID, err)
+		}
+	} else {
+		size = curSize
+	}
+
+	if _, err = crd.WaitForVolumeResized(ctx, volumeID, size); err != nil {
+		return nil, err
+	}
+
+	// block volumes also need the node to rescan the iscsi lun
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         size,
+		NodeExpansionRequired: true,
+	}, nil
 }
 
-func (cs *ControllerServer) ControllerGetVolume(_ context.Context, _ *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+// ControllerGetVolume returns the volume with its published nodes and the health condition
+// reported by the owner node
+func (cs *ControllerServer) ControllerGetVolume(_ context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
 	logger.StdLog.Debugf("running ControllerGetVolume...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented ControllerGetVolume")
+	if err := cs.validateRequest(csi.ControllerServiceCapability_RPC_GET_VOLUME); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "failed to handle get volume request: missing volume id")
+	}
+
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "failed get volume %s: %v", volumeID, err)
+	}
+
+	capacity, _ := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      vol.Name,
+			CapacityBytes: capacity,
+			AccessibleTopology: []*csi.Topology{{
+				Segments: map[string]string{crd.TopologyKey: vol.Spec.OwnerNodeID},
+			},
+			},
+			VolumeContext: map[string]string{crd.VolGroupKey: vol.Spec.VolGroup},
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: getPublishedNodeIDs(vol),
+			VolumeCondition:  getVolumeCondition(vol),
+		},
+	}, nil
 }
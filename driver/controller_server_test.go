@@ -0,0 +1,42 @@
+package driver
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"testing"
+)
+
+func Test_failedSnapshotError(t *testing.T) {
+	tests := []struct {
+		name    string
+		snapErr *apis.VolumeError
+		wantMsg string
+	}{
+		{
+			name:    "error recorded by the owner node",
+			snapErr: &apis.VolumeError{Code: apis.InsufficientCapacity, Message: "insufficient free space"},
+			wantMsg: "snapshot snap-1 failed to create on node node1: InsufficientCapacity: insufficient free space",
+		},
+		{
+			name:    "no error recorded",
+			wantMsg: "snapshot snap-1 failed to create on node node1: unknown error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap := &apis.Snapshot{}
+			snap.Name = "snap-1"
+			snap.Spec.OwnerNodeID = "node1"
+			snap.Status.Error = tt.snapErr
+
+			err := failedSnapshotError(snap)
+			if got := status.Code(err); got != codes.Internal {
+				t.Errorf("failedSnapshotError() got code = %v, want %v", got, codes.Internal)
+			}
+			if got := status.Convert(err).Message(); got != tt.wantMsg {
+				t.Errorf("failedSnapshotError() got = %v, want %v", got, tt.wantMsg)
+			}
+		})
+	}
+}
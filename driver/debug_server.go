@@ -0,0 +1,115 @@
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"net/http"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/driver/dparams"
+	"qiniu.io/rio-csi/driver/scheduler"
+	"qiniu.io/rio-csi/logger"
+	"qiniu.io/rio-csi/utils"
+)
+
+const (
+	// ExplainPath is the debug endpoint to simulate the scheduling of a volume
+	ExplainPath = "/debug/scheduler/explain"
+
+	// explainVolumeName is the volume name of the simulated request if the name is not given
+	explainVolumeName = "scheduler-explain"
+)
+
+// StartDebugServer serves the scheduler debug endpoint at addr in background
+func (cs *ControllerServer) StartDebugServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ExplainPath, cs.explainVolume)
+
+	go func() {
+		logger.StdLog.Infof("start debug server at %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.StdLog.Errorf("debug server %s error %v", addr, err)
+		}
+	}()
+}
+
+// explainVolume dumps the node views of the vg pattern and simulates the placement of a volume,
+// the query params are the storage class params plus size, node and name of the hypothetical volume
+func (cs *ControllerServer) explainVolume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, params, err := parseExplainRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	explanation, err := cs.schedulerManager.ExplainVolume(req, params)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrSchedulerNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.StdLog.Errorf("explain volume %s error %v", req.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(explanation); err != nil {
+		logger.StdLog.Errorf("encode explanation error %v", err)
+	}
+}
+
+// parseExplainRequest builds the create volume request to simulate from the query params
+func parseExplainRequest(r *http.Request) (*csi.CreateVolumeRequest, *dparams.VolumeParams, error) {
+	query := r.URL.Query()
+	parameters := make(map[string]string)
+	for key := range query {
+		parameters[key] = query.Get(key)
+	}
+
+	name := parameters["name"]
+	if name == "" {
+		name = explainVolumeName
+	}
+
+	var required int64
+	if sizeStr := parameters["size"]; sizeStr != "" {
+		size, err := resource.ParseQuantity(sizeStr)
+		if err != nil || size.Value() < 0 {
+			return nil, nil, fmt.Errorf("invalid size %s", sizeStr)
+		}
+		required = utils.GetRoundedCapacity(size.Value())
+	}
+
+	for _, key := range []string{"name", "size", "node"} {
+		delete(parameters, key)
+	}
+
+	params, err := dparams.NewVolumeParams(parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := &csi.CreateVolumeRequest{
+		Name:          name,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: required},
+		Parameters:    parameters,
+	}
+
+	// node limits the volume to the node like the topology of a WaitForFirstConsumer pvc
+	if node := query.Get("node"); node != "" {
+		req.AccessibilityRequirements = &csi.TopologyRequirement{
+			Preferred: []*csi.Topology{{Segments: map[string]string{crd.TopologyKey: node}}},
+		}
+	}
+
+	return req, params, nil
+}
@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"net/http/httptest"
+	"qiniu.io/rio-csi/crd"
+	"reflect"
+	"testing"
+)
+
+func Test_parseExplainRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantName   string
+		wantSize   int64
+		wantParams map[string]string
+		wantNode   string
+		wantErr    bool
+	}{
+		{
+			name:       "default name and size",
+			query:      "vgpattern=riovg.*",
+			wantName:   explainVolumeName,
+			wantParams: map[string]string{"vgpattern": "riovg.*"},
+		},
+		{
+			name:       "size rounded up to Gi",
+			query:      "name=pvc-1&size=1500Mi&vgpattern=riovg.*&thinprovision=yes",
+			wantName:   "pvc-1",
+			wantSize:   2 << 30,
+			wantParams: map[string]string{"vgpattern": "riovg.*", "thinprovision": "yes"},
+		},
+		{
+			name:       "size rounded up to Mi",
+			query:      "size=1000Ki&vgpattern=riovg.*",
+			wantName:   explainVolumeName,
+			wantSize:   1 << 20,
+			wantParams: map[string]string{"vgpattern": "riovg.*"},
+		},
+		{
+			name:       "node topology",
+			query:      "size=10Gi&node=node1&vgpattern=riovg.*",
+			wantName:   explainVolumeName,
+			wantSize:   10 << 30,
+			wantParams: map[string]string{"vgpattern": "riovg.*"},
+			wantNode:   "node1",
+		},
+		{
+			name:    "invalid size",
+			query:   "size=ten&vgpattern=riovg.*",
+			wantErr: true,
+		},
+		{
+			name:    "negative size",
+			query:   "size=-1Gi&vgpattern=riovg.*",
+			wantErr: true,
+		},
+		{
+			name:    "invalid volume params",
+			query:   "vgpattern=riovg.*&scheduler=RoundRobin",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", ExplainPath+"?"+tt.query, nil)
+			req, params, err := parseExplainRequest(r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseExplainRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			if req.Name != tt.wantName {
+				t.Errorf("parseExplainRequest() got name = %v, want %v", req.Name, tt.wantName)
+			}
+			if got := req.GetCapacityRange().GetRequiredBytes(); got != tt.wantSize {
+				t.Errorf("parseExplainRequest() got size = %v, want %v", got, tt.wantSize)
+			}
+			if !reflect.DeepEqual(req.Parameters, tt.wantParams) {
+				t.Errorf("parseExplainRequest() got parameters = %v, want %v", req.Parameters, tt.wantParams)
+			}
+			if params == nil {
+				t.Errorf("parseExplainRequest() got nil volume params")
+			}
+
+			var wantTopology *csi.TopologyRequirement
+			if tt.wantNode != "" {
+				wantTopology = &csi.TopologyRequirement{
+					Preferred: []*csi.Topology{{Segments: map[string]string{crd.TopologyKey: tt.wantNode}}},
+				}
+			}
+			if !reflect.DeepEqual(req.AccessibilityRequirements, wantTopology) {
+				t.Errorf("parseExplainRequest() got topology = %v, want %v", req.AccessibilityRequirements, wantTopology)
+			}
+		})
+	}
+}
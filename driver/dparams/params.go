@@ -2,7 +2,10 @@ package dparams
 
 import (
 	"fmt"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -19,6 +22,16 @@ const (
 	SpaceWeighted = "SpaceWeighted"
 )
 
+// spread mode constants
+const (
+	// the scheduling fails if every node or topology domain has a volume of the spread group
+	SpreadModeHard = "hard"
+
+	// the node or topology domain having less volumes of the spread group is preferred
+	// this will be the default spread mode when none provided
+	SpreadModeSoft = "soft"
+)
+
 // VolumeParams holds collection of supported settings that can
 // be configured in storage class.
 type VolumeParams struct {
@@ -29,6 +42,16 @@ type VolumeParams struct {
 	Scheduler     string
 	Shared        string
 	ThinProvision string
+
+	// SpreadGroup spreads the volumes of the same group across distinct owner nodes
+	// or topology domains, it's overridden by the pvc annotation
+	SpreadGroup string
+	// SpreadMode is hard or soft
+	SpreadMode string
+	// SpreadTopologyKey is the node label of the topology domain to spread across,
+	// eg. topology.kubernetes.io/zone, the volumes are spread across nodes if it's empty
+	SpreadTopologyKey string
+
 	// extra optional metadata passed by external provisioner
 	// if enabled. See --extra-create-metadata flag for more details.
 	// https://github.com/kubernetes-csi/external-provisioner#recommended-optional-arguments
@@ -43,6 +66,7 @@ func NewVolumeParams(m map[string]string) (*VolumeParams, error) {
 		Scheduler:     SpaceWeighted,
 		Shared:        "no",
 		ThinProvision: "no",
+		SpreadMode:    SpreadModeSoft,
 	}
 	// parameter keys may be mistyped from the CRD specification when declaring
 	// the storageclass, which kubectl validation will not catch. Because
@@ -66,9 +90,12 @@ func NewVolumeParams(m map[string]string) (*VolumeParams, error) {
 
 	// parse string params
 	stringParams := map[string]*string{
-		"scheduler":     &params.Scheduler,
-		"shared":        &params.Shared,
-		"thinprovision": &params.ThinProvision,
+		"scheduler":         &params.Scheduler,
+		"shared":            &params.Shared,
+		"thinprovision":     &params.ThinProvision,
+		"spreadgroup":       &params.SpreadGroup,
+		"spreadmode":        &params.SpreadMode,
+		"spreadtopologykey": &params.SpreadTopologyKey,
 	}
 	for key, param := range stringParams {
 		value, ok := m[key]
@@ -78,6 +105,16 @@ func NewVolumeParams(m map[string]string) (*VolumeParams, error) {
 		*param = value
 	}
 
+	switch params.Scheduler {
+	case VolumeWeighted, CapacityWeighted, SpaceWeighted:
+	default:
+		return nil, fmt.Errorf("invalid scheduler param %v", params.Scheduler)
+	}
+
+	if err = params.ValidateSpread(); err != nil {
+		return nil, err
+	}
+
 	params.PVCName = m["csi.storage.k8s.io/pvc/name"]
 	params.PVCNamespace = m["csi.storage.k8s.io/pvc/namespace"]
 	params.PVName = m["csi.storage.k8s.io/pv/name"]
@@ -85,6 +122,19 @@ func NewVolumeParams(m map[string]string) (*VolumeParams, error) {
 	return params, nil
 }
 
+// ValidateSpread checks the spread params, the spread group is stored in a label of the volume
+func (params *VolumeParams) ValidateSpread() error {
+	if params.SpreadMode != SpreadModeHard && params.SpreadMode != SpreadModeSoft {
+		return fmt.Errorf("invalid spread mode %v", params.SpreadMode)
+	}
+
+	if errs := validation.IsValidLabelValue(params.SpreadGroup); len(errs) > 0 {
+		return fmt.Errorf("invalid spread group %v: %s", params.SpreadGroup, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
 // GetCaseInsensitiveMap coercs the map's keys to lower case, which only works
 // when unicode char is in ASCII subset. May overwrite key-value pairs on
 // different permutations of key case as in Key and key. DON'T force values to the
@@ -101,3 +151,61 @@ func GetCaseInsensitiveMap(dict *map[string]string) map[string]string {
 	}
 	return insensitiveDict
 }
+
+// SnapshotParams holds collection of supported settings that can
+// be configured in volume snapshot class.
+type SnapshotParams struct {
+	// SnapSize is the absolute cow space reserved for the snapshot in bytes,
+	// it takes precedence over SnapSizePercent when set.
+	SnapSize int64
+	// SnapSizePercent is the cow space reserved for the snapshot in
+	// percentage of the origin volume capacity.
+	SnapSizePercent int64
+}
+
+// NewSnapshotParams parses the input params and instantiates new SnapshotParams.
+// snapsize accepts either an absolute quantity such as "10Gi" or a percentage
+// of the origin volume such as "20%", the whole origin size is reserved by default.
+func NewSnapshotParams(m map[string]string) (*SnapshotParams, error) {
+	params := &SnapshotParams{ // set up defaults, if any.
+		SnapSizePercent: 100,
+	}
+
+	m = GetCaseInsensitiveMap(&m)
+
+	snapSize, ok := m["snapsize"]
+	if !ok || snapSize == "" {
+		return params, nil
+	}
+
+	if strings.HasSuffix(snapSize, "%") {
+		percent, err := strconv.ParseInt(strings.TrimSuffix(snapSize, "%"), 10, 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid snapsize param %v: percentage must be in (0, 100]", snapSize)
+		}
+
+		params.SnapSizePercent = percent
+		return params, nil
+	}
+
+	quantity, err := resource.ParseQuantity(snapSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapsize param %v: %v", snapSize, err)
+	}
+
+	if quantity.Value() <= 0 {
+		return nil, fmt.Errorf("invalid snapsize param %v: size must be positive", snapSize)
+	}
+
+	params.SnapSize = quantity.Value()
+	return params, nil
+}
+
+// GetSnapSize returns the cow space in bytes reserved for the snapshot of a origin volume
+func (p *SnapshotParams) GetSnapSize(capacity int64) int64 {
+	if p.SnapSize > 0 {
+		return p.SnapSize
+	}
+
+	return capacity * p.SnapSizePercent / 100
+}
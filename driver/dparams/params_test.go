@@ -0,0 +1,161 @@
+package dparams
+
+import (
+	"testing"
+)
+
+func TestNewSnapshotParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]string
+		want    SnapshotParams
+		wantErr bool
+	}{
+		{
+			name: "whole origin size by default",
+			m:    map[string]string{},
+			want: SnapshotParams{SnapSizePercent: 100},
+		},
+		{
+			name: "percentage",
+			m:    map[string]string{"SnapSize": "20%"},
+			want: SnapshotParams{SnapSizePercent: 20},
+		},
+		{
+			name: "quantity",
+			m:    map[string]string{"snapsize": "10Gi"},
+			want: SnapshotParams{SnapSize: 10 << 30, SnapSizePercent: 100},
+		},
+		{
+			name:    "percentage out of range",
+			m:       map[string]string{"snapsize": "120%"},
+			wantErr: true,
+		},
+		{
+			name:    "zero quantity",
+			m:       map[string]string{"snapsize": "0"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSnapshotParams(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSnapshotParams() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("NewSnapshotParams() got = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotParams_GetSnapSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   SnapshotParams
+		capacity int64
+		want     int64
+	}{
+		{
+			name:     "percentage of the origin",
+			params:   SnapshotParams{SnapSizePercent: 20},
+			capacity: 100 << 30,
+			want:     20 << 30,
+		},
+		{
+			name:     "absolute size takes precedence",
+			params:   SnapshotParams{SnapSize: 5 << 30, SnapSizePercent: 20},
+			capacity: 100 << 30,
+			want:     5 << 30,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.params.GetSnapSize(tt.capacity); got != tt.want {
+				t.Errorf("GetSnapSize() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewVolumeParams_Scheduler(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default scheduler",
+			m:    map[string]string{"vgpattern": "riovg.*"},
+			want: SpaceWeighted,
+		},
+		{
+			name: "volume weighted",
+			m:    map[string]string{"vgpattern": "riovg.*", "Scheduler": VolumeWeighted},
+			want: VolumeWeighted,
+		},
+		{
+			name: "capacity weighted",
+			m:    map[string]string{"volgroup": "riovg", "scheduler": CapacityWeighted},
+			want: CapacityWeighted,
+		},
+		{
+			name:    "unsupported scheduler",
+			m:       map[string]string{"vgpattern": "riovg.*", "scheduler": "RoundRobin"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewVolumeParams(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewVolumeParams() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Scheduler != tt.want {
+				t.Errorf("NewVolumeParams() got = %v, want %v", got.Scheduler, tt.want)
+			}
+		})
+	}
+}
+
+func TestVolumeParams_ValidateSpread(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  VolumeParams
+		wantErr bool
+	}{
+		{
+			name:   "no spread group",
+			params: VolumeParams{SpreadMode: SpreadModeSoft},
+		},
+		{
+			name:   "soft spread",
+			params: VolumeParams{SpreadGroup: "mysql-cluster", SpreadMode: SpreadModeSoft},
+		},
+		{
+			name:   "hard spread",
+			params: VolumeParams{SpreadGroup: "mysql-cluster", SpreadMode: SpreadModeHard},
+		},
+		{
+			name:    "invalid spread mode",
+			params:  VolumeParams{SpreadGroup: "mysql-cluster", SpreadMode: "strict"},
+			wantErr: true,
+		},
+		{
+			name:    "spread group is not a label value",
+			params:  VolumeParams{SpreadGroup: "mysql/cluster", SpreadMode: SpreadModeHard},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.params.ValidateSpread(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSpread() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -10,6 +10,8 @@ type RioCSI struct {
 	nodeID   string
 	version  string
 	endpoint string
+	// debugAddr is the addr of the scheduler debug server of the controller, empty means disabled
+	debugAddr string
 
 	iscsiUsername string
 	iscsiPassword string
@@ -23,7 +25,7 @@ type RioCSI struct {
 	serviceCapabilities []*csi.ControllerServiceCapability
 }
 
-func NewCSIDriver(name, version, nodeID, endpoint, iscsiUsername, iscsiPassword string, enableIdentityServer, enableControllerServer, enableNodeServer bool) *RioCSI {
+func NewCSIDriver(name, version, nodeID, endpoint, debugAddr, iscsiUsername, iscsiPassword string, enableIdentityServer, enableControllerServer, enableNodeServer bool) *RioCSI {
 	logger.StdLog.Infof("Driver: %s version: %s", name, version)
 
 	n := &RioCSI{
@@ -31,6 +33,7 @@ func NewCSIDriver(name, version, nodeID, endpoint, iscsiUsername, iscsiPassword
 		nodeID:                 nodeID,
 		version:                version,
 		endpoint:               endpoint,
+		debugAddr:              debugAddr,
 		iscsiUsername:          iscsiUsername,
 		iscsiPassword:          iscsiPassword,
 		enableIdentityServer:   enableIdentityServer,
@@ -40,15 +43,27 @@ func NewCSIDriver(name, version, nodeID, endpoint, iscsiUsername, iscsiPassword
 
 	// Add access modes for CSI here
 	n.AddVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
 		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
 	})
 
 	// Add service capabilities for CSI here
 	n.AddControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
-		//csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
 	})
 
 	return n
@@ -66,7 +81,15 @@ func (n *RioCSI) Run() {
 
 	if n.enableControllerServer {
 		logger.StdLog.Info("Enable gRPC Server: ControllerServer")
-		controllerServer = NewControllerServer(n)
+		cs := NewControllerServer(n)
+		controllerServer = cs
+
+		if n.debugAddr != "" {
+			cs.StartDebugServer(n.debugAddr)
+		}
+
+		// clean the volumes leaked by the pvc deleted during provisioning
+		go StartVolumeLeakProtection(leakCheckInterval, leakGracePeriod)
 	}
 	if n.enableNodeServer {
 		logger.StdLog.Info("Enable gRPC Server: NodeServer")
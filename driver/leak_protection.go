@@ -0,0 +1,136 @@
+package driver
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/driver/dparams"
+	"qiniu.io/rio-csi/logger"
+	"time"
+)
+
+const (
+	// leakCheckInterval is the interval to check the leaked volumes
+	leakCheckInterval = time.Minute
+	// leakGracePeriod is the time a volume is protected after it's created,
+	// the provisioner may still be waiting the volume to create the pv
+	leakGracePeriod = 10 * time.Minute
+)
+
+// leakProtectionAnnotations returns the annotations to mark the volume created for the pvc for leak protection,
+// it's empty if the pvc is unknown, eg. the provisioner runs without --extra-create-metadata
+func leakProtectionAnnotations(params *dparams.VolumeParams) map[string]string {
+	if params.PVCName == "" || params.PVCNamespace == "" {
+		return nil
+	}
+
+	return map[string]string{
+		crd.PVCNameKey:        params.PVCName,
+		crd.PVCNamespaceKey:   params.PVCNamespace,
+		crd.LeakProtectionKey: "true",
+	}
+}
+
+// StartVolumeLeakProtection deletes the leaked volumes every interval
+func StartVolumeLeakProtection(interval, gracePeriod time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		<-timer.C
+		CleanLeakedVolumes(gracePeriod)
+		timer.Reset(interval)
+	}
+}
+
+// CleanLeakedVolumes deletes the volumes whose pvc has been deleted before the pv is created,
+// a volume under leak protection is released once its pv is found
+func CleanLeakedVolumes(gracePeriod time.Duration) {
+	ctx := context.Background()
+	pvs, err := client.DefaultClient.ClientSet.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.StdLog.Errorf("CleanLeakedVolumes: list pv error %v", err)
+		return
+	}
+
+	pvVolumes := make(map[string]bool, len(pvs.Items))
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil {
+			pvVolumes[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+
+	skip := ""
+	limit := int64(100)
+	for {
+		resp, conStr, err := crd.ListVolumes(skip, limit)
+		if err != nil {
+			logger.StdLog.Errorf("CleanLeakedVolumes: ListVolumes skip %s limit %d error %v", skip, limit, err)
+			return
+		}
+
+		for i := range resp {
+			vol := &resp[i]
+			if vol.Annotations[crd.LeakProtectionKey] != "true" || vol.GetDeletionTimestamp() != nil {
+				continue
+			}
+
+			if pvVolumes[vol.Name] {
+				releaseLeakProtection(vol)
+				continue
+			}
+
+			if time.Since(vol.CreationTimestamp.Time) < gracePeriod {
+				continue
+			}
+
+			leaked, err := isVolumeLeaked(ctx, vol)
+			if err != nil {
+				logger.StdLog.Errorf("CleanLeakedVolumes: check volume %s error %v", vol.Name, err)
+				continue
+			}
+
+			if !leaked {
+				continue
+			}
+
+			logger.StdLog.Infof("volume %s is leaked, its pvc %s/%s is gone and no pv is created, delete it",
+				vol.Name, vol.Annotations[crd.PVCNamespaceKey], vol.Annotations[crd.PVCNameKey])
+			if err = crd.DeleteVolume(vol.Name); err != nil && !k8serror.IsNotFound(err) {
+				logger.StdLog.Errorf("CleanLeakedVolumes: delete volume %s error %v", vol.Name, err)
+			}
+		}
+
+		if conStr == "" {
+			return
+		}
+		skip = conStr
+	}
+}
+
+// isVolumeLeaked returns whether the pvc of the volume has been deleted or has been bound to another pv
+func isVolumeLeaked(ctx context.Context, vol *apis.Volume) (bool, error) {
+	pvc, err := client.DefaultClient.ClientSet.CoreV1().PersistentVolumeClaims(vol.Annotations[crd.PVCNamespaceKey]).
+		Get(ctx, vol.Annotations[crd.PVCNameKey], metav1.GetOptions{})
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return pvc.Status.Phase == corev1.ClaimBound && pvc.Spec.VolumeName != vol.Name, nil
+}
+
+// releaseLeakProtection removes the leak protection annotation of the volume whose pv has been created,
+// so the volume retained by the pv is never deleted by the leak protection
+func releaseLeakProtection(vol *apis.Volume) {
+	newVol := vol.DeepCopy()
+	delete(newVol.Annotations, crd.LeakProtectionKey)
+	if _, err := crd.UpdateVolume(newVol); err != nil {
+		logger.StdLog.Errorf("release volume %s leak protection error %v", vol.Name, err)
+	}
+}
@@ -0,0 +1,150 @@
+package driver
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/driver/dparams"
+	"qiniu.io/rio-csi/lib/lvm/builder/volbuilder"
+	"qiniu.io/rio-csi/lib/mount"
+	"qiniu.io/rio-csi/lib/mount/mtypes"
+	"qiniu.io/rio-csi/logger"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EphemeralContextKey is set to "true" by kubelet in the volume context of csi ephemeral inline volume
+	EphemeralContextKey = "csi.storage.k8s.io/ephemeral"
+	// EphemeralSizeKey is the volume attribute of the ephemeral volume size, eg. 10Gi
+	EphemeralSizeKey = "size"
+)
+
+// isEphemeralVolume returns whether the node publish request is for a csi ephemeral inline volume
+func isEphemeralVolume(req *csi.NodePublishVolumeRequest) bool {
+	return req.GetVolumeContext()[EphemeralContextKey] == "true"
+}
+
+// publishEphemeralVolume creates the Volume CR of the ephemeral inline volume on this node,
+// waits the node agent provision the logical volume and mounts it at the target path
+func (ns *NodeServer) publishEphemeralVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	if req.GetVolumeCapability().GetMount() == nil {
+		return nil, status.Error(codes.InvalidArgument, "ephemeral volume only supports FileSystem mode")
+	}
+
+	volName := strings.ToLower(req.GetVolumeId())
+	attributes := dparams.GetCaseInsensitiveMap(&req.VolumeContext)
+	params, err := dparams.NewVolumeParams(attributes)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse ephemeral volume attributes: %v", err)
+	}
+
+	sizeStr, ok := attributes[EphemeralSizeKey]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "ephemeral volume attribute %s missing", EphemeralSizeKey)
+	}
+
+	size, err := resource.ParseQuantity(sizeStr)
+	if err != nil || size.Value() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid ephemeral volume size %s", sizeStr)
+	}
+
+	podInfo, err := getPodLVInfo(req)
+	if err != nil {
+		logger.StdLog.Errorf("PodInfo could not be obtained for volume_id: %s, err = %v", req.VolumeId, err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	_, err = crd.GetVolume(volName)
+	if err != nil {
+		if !k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.Internal, "get ephemeral volume %s error %v", volName, err)
+		}
+
+		if _, err = ns.provisionEphemeralVolume(volName, size.Value(), params); err != nil {
+			return nil, err
+		}
+	}
+
+	vol, err := crd.WaitForVolumeReady(ctx, volName)
+	if err != nil {
+		return nil, err
+	}
+
+	if vol.Status.State == crd.StatusFailed {
+		msg := ""
+		if vol.Status.Error != nil {
+			msg = vol.Status.Error.Message
+		}
+
+		// remove the failed volume so the retry can create it again
+		if err = crd.DeleteVolume(volName); err != nil {
+			logger.StdLog.Errorf("delete failed ephemeral volume %s error %v", volName, err)
+		}
+
+		return nil, status.Errorf(codes.ResourceExhausted, "failed to create ephemeral volume %s: %s", volName, msg)
+	}
+
+	volumeInfo := &mtypes.VolumeInfo{
+		FSType:       req.GetVolumeCapability().GetMount().GetFsType(),
+		MountPath:    req.GetTargetPath(),
+		MountOptions: append([]string{}, req.GetVolumeCapability().GetMount().GetMountFlags()...),
+		AccessModes:  []string{req.GetVolumeCapability().GetAccessMode().GetMode().String()},
+	}
+
+	if req.GetReadonly() {
+		volumeInfo.MountOptions = append(volumeInfo.MountOptions, "ro")
+	} else {
+		volumeInfo.MountOptions = append(volumeInfo.MountOptions, "rw")
+	}
+
+	mountInfo := &mtypes.Info{
+		MountType:  mtypes.TypeFileSystem,
+		VolumeInfo: volumeInfo,
+		PodInfo:    podInfo,
+	}
+
+	err = mount.MountEphemeralVolume(vol, mountInfo)
+	if err != nil {
+		logger.StdLog.Error(err)
+		return nil, err
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// provisionEphemeralVolume creates the Volume CR owned by this node for the ephemeral inline volume
+func (ns *NodeServer) provisionEphemeralVolume(volName string, size int64, params *dparams.VolumeParams) (*apis.Volume, error) {
+	newVol, err := volbuilder.NewBuilder().
+		WithName(volName).
+		WithCapacity(strconv.FormatInt(size, 10)).
+		WithVgPattern(params.VgPattern.String()).
+		WithOwnerNode(ns.Driver.nodeID).
+		WithVolumeStatus(crd.StatusPending).
+		WithShared("no").
+		WithReadOnly("no").
+		WithThinProvision(params.ThinProvision).
+		WithLabels(map[string]string{crd.EphemeralKey: "true"}).Build()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// set default iscsi lun is -1 means no lun device
+	newVol.Spec.IscsiLun = -1
+
+	newVol, err = crd.ProvisionVolume(newVol)
+	if err != nil {
+		if k8serror.IsAlreadyExists(err) {
+			return crd.GetVolume(volName)
+		}
+		return nil, status.Errorf(codes.Internal, "not able to provision the ephemeral volume %s", err.Error())
+	}
+
+	logger.StdLog.Infof("provisioned ephemeral volume %s size %d on node %s", volName, size, ns.Driver.nodeID)
+	return newVol, nil
+}
@@ -7,11 +7,15 @@ import (
 	"golang.org/x/sys/unix"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"os"
 	apis "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/lib/mount"
 	"qiniu.io/rio-csi/lib/mount/mtypes"
 	"qiniu.io/rio-csi/logger"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -28,7 +32,7 @@ type NodeServer struct {
 	//mounter mount.Interface
 }
 
-func (ns *NodeServer) NodePublishVolume(_ context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+func (ns *NodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	var (
 		err error
 	)
@@ -37,6 +41,10 @@ func (ns *NodeServer) NodePublishVolume(_ context.Context, req *csi.NodePublishV
 		return nil, err
 	}
 
+	if isEphemeralVolume(req) {
+		return ns.publishEphemeralVolume(ctx, req)
+	}
+
 	vol, volumeInfo, err := GetVolAndMountInfo(req)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -49,6 +57,13 @@ func (ns *NodeServer) NodePublishVolume(_ context.Context, req *csi.NodePublishV
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	// the volume CR update of publish fails on conflict if the volume
+	// is published concurrently so the check is consistent
+	if err = checkPublishAccessMode(vol, podInfo, req.GetVolumeCapability().GetAccessMode().GetMode()); err != nil {
+		logger.StdLog.Errorf("volume %s cant be published to pod %s/%s: %v", vol.Name, podInfo.Namespace, podInfo.Name, err)
+		return nil, err
+	}
+
 	mountInfo := &mtypes.Info{
 		VolumeInfo: volumeInfo,
 		PodInfo:    podInfo,
@@ -63,7 +78,7 @@ func (ns *NodeServer) NodePublishVolume(_ context.Context, req *csi.NodePublishV
 		mountInfo.MountType = mtypes.TypeFileSystem
 	}
 
-	err = mount.MountVolume(vol, mountInfo, ns.Driver.iscsiUsername, ns.Driver.iscsiPassword)
+	err = mount.PublishVolume(vol, mountInfo, req.GetStagingTargetPath())
 
 	if err != nil {
 		logger.StdLog.Error(err)
@@ -114,7 +129,8 @@ func (ns *NodeServer) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpubl
 		return nil, fmt.Errorf("update volume error %v", err)
 	}
 
-	err = mount.UmountVolume(vol, targetPath, ns.Driver.iscsiUsername, ns.Driver.iscsiPassword, rawDevicePaths, true)
+	// the iscsi session is kept until the volume is unstaged from the node
+	err = mount.UmountVolume(vol, targetPath, ns.Driver.iscsiUsername, ns.Driver.iscsiPassword, rawDevicePaths, false)
 
 	if err != nil {
 		return nil, status.Errorf(codes.Internal,
@@ -124,9 +140,21 @@ func (ns *NodeServer) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpubl
 	logger.StdLog.Infof("hostpath: volume %s path: %s has been unmounted.",
 		volumeID, targetPath)
 
+	// ephemeral inline volume lives as long as the pod
+	if crd.IsEphemeralVolume(vol) {
+		if err = crd.DeleteVolume(vol.Name); err != nil && !k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.Internal,
+				"unable to delete the ephemeral volume %s err : %s",
+				volumeID, err.Error())
+		}
+		logger.StdLog.Infof("ephemeral volume %s has been deleted", volumeID)
+	}
+
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
+// NodeGetVolumeStats reports the filesystem usage or the block device size of the volume
+// with the volume condition checked on this node
 func (ns *NodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
 
 	volID := req.GetVolumeId()
@@ -140,52 +168,213 @@ func (ns *NodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 		return nil, status.Error(codes.InvalidArgument, "path is not provided")
 	}
 
+	vol, err := crd.GetVolume(strings.ToLower(volID))
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volID)
+		}
+		return nil, status.Errorf(codes.Internal, "not able to get the volume %s err : %s", volID, err.Error())
+	}
+
 	if !mount.IsMountPath(path) {
 		return nil, status.Error(codes.NotFound, "path is not a mount path")
 	}
 
-	var sfs unix.Statfs_t
-	if err := unix.Statfs(path, &sfs); err != nil {
-		return nil, status.Errorf(codes.Internal, "statfs on %s failed: %v", path, err)
+	var fi os.FileInfo
+	if fi, err = os.Stat(path); err != nil {
+		return nil, status.Errorf(codes.NotFound, "stat on %s failed: %v", path, err)
+	}
+
+	// the condition is checked first, a missing or broken device is reported as abnormal
+	// instead of failing the rpc
+	abnormal, message := mount.CheckVolumeCondition(vol, getNodeMountInfo(vol, ns.Driver.nodeID, path), path)
+	condition := &csi.VolumeCondition{
+		Abnormal: abnormal,
+		Message:  message,
 	}
 
 	var usage []*csi.VolumeUsage
-	usage = append(usage, &csi.VolumeUsage{
-		Unit:      csi.VolumeUsage_BYTES,
-		Total:     int64(sfs.Blocks) * int64(sfs.Bsize),
-		Used:      int64(sfs.Blocks-sfs.Bfree) * int64(sfs.Bsize),
-		Available: int64(sfs.Bavail) * int64(sfs.Bsize),
-	})
-	usage = append(usage, &csi.VolumeUsage{
-		Unit:      csi.VolumeUsage_INODES,
-		Total:     int64(sfs.Files),
-		Used:      int64(sfs.Files - sfs.Ffree),
-		Available: int64(sfs.Ffree),
-	})
-
-	return &csi.NodeGetVolumeStatsResponse{Usage: usage}, nil
+	if fi.Mode()&os.ModeDevice != 0 {
+		// block volume is bind mounted to a file, only the total size is known
+		size, err := mount.GetBlockDeviceSize(path)
+		if err != nil {
+			logger.StdLog.Errorf("get block device size of %s failed: %v", path, err)
+			return abnormalVolumeStats(condition, fmt.Sprintf("get block device size of %s failed: %v", path, err)), nil
+		}
+
+		usage = append(usage, &csi.VolumeUsage{
+			Unit:  csi.VolumeUsage_BYTES,
+			Total: size,
+		})
+	} else {
+		var sfs unix.Statfs_t
+		if err := unix.Statfs(path, &sfs); err != nil {
+			logger.StdLog.Errorf("statfs on %s failed: %v", path, err)
+			return abnormalVolumeStats(condition, fmt.Sprintf("statfs on %s failed: %v", path, err)), nil
+		}
+
+		usage = append(usage, &csi.VolumeUsage{
+			Unit:      csi.VolumeUsage_BYTES,
+			Total:     int64(sfs.Blocks) * int64(sfs.Bsize),
+			Used:      int64(sfs.Blocks-sfs.Bfree) * int64(sfs.Bsize),
+			Available: int64(sfs.Bavail) * int64(sfs.Bsize),
+		})
+		usage = append(usage, &csi.VolumeUsage{
+			Unit:      csi.VolumeUsage_INODES,
+			Total:     int64(sfs.Files),
+			Used:      int64(sfs.Files - sfs.Ffree),
+			Available: int64(sfs.Ffree),
+		})
+	}
+
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage:           usage,
+		VolumeCondition: condition,
+	}, nil
 }
 
-func (ns *NodeServer) NodeUnstageVolume(_ context.Context, _ *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
-	logger.StdLog.Debugf("running NodeUnstageVolume...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented NodeUnstageVolume")
+// abnormalVolumeStats returns the stats of the volume whose usage can't be read, the condition
+// found by the volume check is kept and the usage error is reported if the check found nothing
+func abnormalVolumeStats(condition *csi.VolumeCondition, message string) *csi.NodeGetVolumeStatsResponse {
+	if !condition.Abnormal {
+		condition = &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  message,
+		}
+	}
+
+	return &csi.NodeGetVolumeStatsResponse{
+		VolumeCondition: condition,
+	}
 }
 
-func (ns *NodeServer) NodeStageVolume(_ context.Context, _ *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
-	logger.StdLog.Debugf("running NodeStageVolume...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented NodeStageVolume")
+// NodeUnstageVolume unmounts the volume from the staging path and logs out the iscsi session on the node
+func (ns *NodeServer) NodeUnstageVolume(_ context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	if err := ns.validateNodeUnstageReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	stagingPath := req.GetStagingTargetPath()
+	logger.StdLog.Infof("received request to unstage volume %s path %s", volumeID, stagingPath)
+
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "not able to get the volume %s err : %s", volumeID, err.Error())
+	}
+
+	err = mount.UnstageVolume(vol, ns.Driver.nodeID, stagingPath, ns.Driver.iscsiUsername, ns.Driver.iscsiPassword)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to unstage the volume %s err : %s", volumeID, err.Error())
+	}
+
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+// NodeStageVolume logs in the volume iscsi target and mounts the filesystem at the staging path,
+// the pods on the node bind mount the staging path when publishing
+func (ns *NodeServer) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	if err := ns.validateNodeStageReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	stagingPath := req.GetStagingTargetPath()
+	logger.StdLog.Infof("received request to stage volume %s path %s", volumeID, stagingPath)
+
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "not able to get the volume %s err : %s", volumeID, err.Error())
+	}
+
+	stageInfo := &mtypes.StageInfo{
+		NodeId: ns.Driver.nodeID,
+		VolumeInfo: &mtypes.VolumeInfo{
+			FSType:       req.GetVolumeCapability().GetMount().GetFsType(),
+			MountPath:    stagingPath,
+			MountOptions: req.GetVolumeCapability().GetMount().GetMountFlags(),
+			AccessModes:  []string{req.GetVolumeCapability().GetAccessMode().GetMode().String()},
+			// the logical volume is on this node, skip the iscsi loopback
+			Local: ns.Driver.nodeID == vol.Spec.OwnerNodeID,
+		},
+	}
+
+	switch req.GetVolumeCapability().GetAccessType().(type) {
+	case *csi.VolumeCapability_Block:
+		stageInfo.MountType = mtypes.TypeBlock
+		// read only block device is exposed by the write-protected iscsi device,
+		// the local logical volume can't be set read only as it's shared with the target
+		if mount.IsReadOnly(stageInfo.VolumeInfo) {
+			stageInfo.VolumeInfo.Local = false
+		}
+	case *csi.VolumeCapability_Mount:
+		stageInfo.MountType = mtypes.TypeFileSystem
+	}
+
+	err = mount.StageVolume(vol, stageInfo, ns.Driver.iscsiUsername, ns.Driver.iscsiPassword)
+	if err != nil {
+		logger.StdLog.Error(err)
+		return nil, err
+	}
+
+	return &csi.NodeStageVolumeResponse{}, nil
 }
 
-func (ns *NodeServer) NodeExpandVolume(_ context.Context, _ *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
-	logger.StdLog.Debugf("running NodeExpandVolume...")
-	return nil, status.Error(codes.Unimplemented, "Unimplemented NodeExpandVolume")
+// NodeExpandVolume rescans the iscsi lun of an expanded volume and grows the
+// filesystem on it online
+func (ns *NodeServer) NodeExpandVolume(_ context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
+	if err := ns.validateNodeExpandReq(req); err != nil {
+		return nil, err
+	}
+
+	volumeID := strings.ToLower(req.GetVolumeId())
+	volumePath := req.GetVolumePath()
+	logger.StdLog.Infof("received request to expand volume %s path %s", volumeID, volumePath)
+
+	vol, err := crd.GetVolume(volumeID)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "not able to get the volume %s err : %s", volumeID, err.Error())
+	}
+
+	mountInfo := getNodeMountInfo(vol, ns.Driver.nodeID, volumePath)
+	if mountInfo == nil {
+		return nil, status.Errorf(codes.NotFound, "volume %s is not published at %s on node %s",
+			volumeID, volumePath, ns.Driver.nodeID)
+	}
+
+	err = mount.ExpandVolume(vol, mountInfo, ns.Driver.iscsiUsername, ns.Driver.iscsiPassword)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to expand the volume %s err : %s", volumeID, err.Error())
+	}
+
+	capacity, err := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cant parse vol %s capacity %s", vol.Name, vol.Spec.Capacity)
+	}
+
+	return &csi.NodeExpandVolumeResponse{
+		CapacityBytes: capacity,
+	}, nil
 }
 
 func (ns *NodeServer) NodeGetInfo(_ context.Context, _ *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 	logger.StdLog.Infof("Using default NodeGetInfo")
+	// the topology segment lets the provisioner publish the storage capacity of the node
 	return &csi.NodeGetInfoResponse{
 		NodeId:            ns.Driver.nodeID,
 		MaxVolumesPerNode: 65535,
+		AccessibleTopology: &csi.Topology{
+			Segments: map[string]string{crd.TopologyKey: ns.Driver.nodeID},
+		},
 	}, nil
 }
 
@@ -194,6 +383,13 @@ func (ns *NodeServer) NodeGetCapabilities(_ context.Context, _ *csi.NodeGetCapab
 
 	return &csi.NodeGetCapabilitiesResponse{
 		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+					},
+				},
+			},
 			{
 				Type: &csi.NodeServiceCapability_Rpc{
 					Rpc: &csi.NodeServiceCapability_RPC{
@@ -201,6 +397,27 @@ func (ns *NodeServer) NodeGetCapabilities(_ context.Context, _ *csi.NodeGetCapab
 					},
 				},
 			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
 		},
 	}, nil
 }
@@ -3,14 +3,18 @@ package driver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apis "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/client"
 	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/lib/lvm"
 	"qiniu.io/rio-csi/lib/mount/mtypes"
+	"qiniu.io/rio-csi/logger"
 	"strings"
 )
 
@@ -24,6 +28,43 @@ func (ns *NodeServer) validateNodePublishReq(req *csi.NodePublishVolumeRequest)
 		return status.Error(codes.InvalidArgument,
 			"Volume ID missing in request")
 	}
+
+	// ephemeral inline volume is not staged
+	if req.GetStagingTargetPath() == "" && !isEphemeralVolume(req) {
+		return status.Error(codes.InvalidArgument,
+			"Staging target path missing in request")
+	}
+	return nil
+}
+
+func (ns *NodeServer) validateNodeStageReq(req *csi.NodeStageVolumeRequest) error {
+	if req.GetVolumeCapability() == nil {
+		return status.Error(codes.InvalidArgument,
+			"Volume capability missing in request")
+	}
+
+	if req.GetVolumeId() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Volume ID missing in request")
+	}
+
+	if req.GetStagingTargetPath() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Staging target path missing in request")
+	}
+	return nil
+}
+
+func (ns *NodeServer) validateNodeUnstageReq(req *csi.NodeUnstageVolumeRequest) error {
+	if req.GetVolumeId() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Volume ID missing in request")
+	}
+
+	if req.GetStagingTargetPath() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Staging target path missing in request")
+	}
 	return nil
 }
 
@@ -40,6 +81,117 @@ func (ns *NodeServer) validateNodeUnPublishReq(req *csi.NodeUnpublishVolumeReque
 	return nil
 }
 
+func (ns *NodeServer) validateNodeExpandReq(req *csi.NodeExpandVolumeRequest) error {
+	if req.GetVolumeId() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Volume ID missing in request")
+	}
+
+	if req.GetVolumePath() == "" {
+		return status.Error(codes.InvalidArgument,
+			"Volume path missing in request")
+	}
+	return nil
+}
+
+// checkPublishAccessMode checks the volume can be published to the pod by the access mode and
+// the shared flag, the pods recorded in the mount nodes that no longer exist are ignored
+func checkPublishAccessMode(vol *apis.Volume, podInfo *mtypes.PodInfo, mode csi.VolumeCapability_AccessMode_Mode) error {
+	for _, info := range vol.Spec.MountNodes {
+		if info == nil || info.PodInfo == nil || info.PodInfo.UID == podInfo.UID {
+			continue
+		}
+
+		other := info.PodInfo
+		reason := publishConflict(vol, podInfo, other, mode)
+		if reason == "" {
+			continue
+		}
+
+		_, err := client.DefaultClient.ClientSet.CoreV1().Pods(other.Namespace).Get(context.Background(), other.Name, metav1.GetOptions{})
+		if err != nil {
+			if k8serror.IsNotFound(err) {
+				logger.StdLog.Warnf("volume %s mount record of pod %s/%s on node %s is stale, ignore it",
+					vol.Name, other.Namespace, other.Name, other.NodeId)
+				continue
+			}
+			return status.Errorf(codes.Internal, "get pod %s/%s publishing volume %s error %v",
+				other.Namespace, other.Name, vol.Name, err)
+		}
+
+		return status.Errorf(codes.FailedPrecondition,
+			"%s, volume %s is already published to pod %s/%s on node %s",
+			reason, vol.Name, other.Namespace, other.Name, other.NodeId)
+	}
+
+	return nil
+}
+
+// publishConflict returns why the volume published to the other pod can't be published to the pod.
+// Single node access modes and volume not shared reject pods on other nodes unless it's used read only,
+// SINGLE_NODE_SINGLE_WRITER rejects any other pod
+func publishConflict(vol *apis.Volume, podInfo, other *mtypes.PodInfo, mode csi.VolumeCapability_AccessMode_Mode) string {
+	switch {
+	case mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER:
+		return fmt.Sprintf("access mode %s allows only one pod", mode)
+	case isSingleNodeAccessMode(mode) && other.NodeId != podInfo.NodeId:
+		return fmt.Sprintf("access mode %s allows only one node", mode)
+	case vol.Spec.Shared != lvm.YES && !isReadOnlyAccessMode(mode) && other.NodeId != podInfo.NodeId:
+		return "volume is not shared"
+	}
+
+	return ""
+}
+
+// isSingleNodeAccessMode returns whether the access mode allows the volume to be published to only one node
+func isSingleNodeAccessMode(mode csi.VolumeCapability_AccessMode_Mode) bool {
+	switch mode {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:
+		return true
+	}
+
+	return false
+}
+
+// getNodeMountInfo get the mount info of volume published at path on node,
+// if path is not recorded any mount info of the volume on node is returned as
+// they share the same iscsi device
+func getNodeMountInfo(vol *apis.Volume, nodeID, path string) *mtypes.Info {
+	var nodeInfo *mtypes.Info
+	for _, info := range vol.Spec.MountNodes {
+		if info.PodInfo == nil || info.VolumeInfo == nil || info.PodInfo.NodeId != nodeID {
+			continue
+		}
+
+		if info.VolumeInfo.MountPath == path {
+			return info
+		}
+
+		if nodeInfo == nil {
+			nodeInfo = info
+		}
+	}
+
+	// fall back to the stage info when the volume is staged but not published yet
+	if nodeInfo == nil {
+		for _, stageInfo := range vol.Spec.StageNodes {
+			if stageInfo == nil || stageInfo.VolumeInfo == nil || stageInfo.NodeId != nodeID {
+				continue
+			}
+
+			return &mtypes.Info{
+				MountType:  stageInfo.MountType,
+				VolumeInfo: stageInfo.VolumeInfo,
+			}
+		}
+	}
+
+	return nodeInfo
+}
+
 // GetVolAndMountInfo get volume and mount info from node csi volume request
 func GetVolAndMountInfo(req *csi.NodePublishVolumeRequest) (*apis.Volume, *mtypes.VolumeInfo, error) {
 	var info mtypes.VolumeInfo
@@ -48,7 +200,10 @@ func GetVolAndMountInfo(req *csi.NodePublishVolumeRequest) (*apis.Volume, *mtype
 	info.MountPath = req.GetTargetPath()
 	info.MountOptions = append(info.MountOptions, req.GetVolumeCapability().GetMount().GetMountFlags()...)
 
-	if req.GetReadonly() {
+	mode := req.GetVolumeCapability().GetAccessMode().GetMode()
+	info.AccessModes = []string{mode.String()}
+
+	if req.GetReadonly() || isReadOnlyAccessMode(mode) {
 		info.MountOptions = append(info.MountOptions, "ro")
 	} else {
 		info.MountOptions = append(info.MountOptions, "rw")
@@ -0,0 +1,126 @@
+package driver
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/lib/mount/mtypes"
+	"testing"
+)
+
+func Test_publishConflict(t *testing.T) {
+	pod := &mtypes.PodInfo{UID: "pod1", NodeId: "node1"}
+	sameNodePod := &mtypes.PodInfo{UID: "pod2", NodeId: "node1"}
+	otherNodePod := &mtypes.PodInfo{UID: "pod3", NodeId: "node2"}
+
+	tests := []struct {
+		name   string
+		shared string
+		other  *mtypes.PodInfo
+		mode   csi.VolumeCapability_AccessMode_Mode
+		want   string
+	}{
+		{
+			name:   "single writer rejects pod on the same node",
+			shared: "yes",
+			other:  sameNodePod,
+			mode:   csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+			want:   "access mode SINGLE_NODE_SINGLE_WRITER allows only one pod",
+		},
+		{
+			name:   "single node writer allows pod on the same node",
+			shared: "no",
+			other:  sameNodePod,
+			mode:   csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			want:   "",
+		},
+		{
+			name:   "single node multi writer allows pod on the same node",
+			shared: "no",
+			other:  sameNodePod,
+			mode:   csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+			want:   "",
+		},
+		{
+			name:   "single node writer rejects pod on other node",
+			shared: "yes",
+			other:  otherNodePod,
+			mode:   csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			want:   "access mode SINGLE_NODE_WRITER allows only one node",
+		},
+		{
+			name:   "volume not shared rejects writer on other node",
+			shared: "no",
+			other:  otherNodePod,
+			mode:   csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			want:   "volume is not shared",
+		},
+		{
+			name:   "volume not shared allows reader on other node",
+			shared: "no",
+			other:  otherNodePod,
+			mode:   csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+			want:   "",
+		},
+		{
+			name:   "shared volume allows writer on other node",
+			shared: "yes",
+			other:  otherNodePod,
+			mode:   csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vol := &apis.Volume{Spec: apis.VolumeSpec{Shared: tt.shared}}
+			if got := publishConflict(vol, pod, tt.other, tt.mode); got != tt.want {
+				t.Errorf("publishConflict() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkPublishAccessMode(t *testing.T) {
+	pod := &mtypes.PodInfo{UID: "pod1", Name: "app-1", NodeId: "node1"}
+
+	tests := []struct {
+		name       string
+		mountNodes []*mtypes.Info
+		mode       csi.VolumeCapability_AccessMode_Mode
+	}{
+		{
+			name: "first pod",
+			mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+		{
+			name: "same pod publishes again",
+			mountNodes: []*mtypes.Info{
+				{PodInfo: &mtypes.PodInfo{UID: "pod1", Name: "app-1", NodeId: "node1"}},
+			},
+			mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		},
+		{
+			name: "second pod on the same node publishes the volume not shared",
+			mountNodes: []*mtypes.Info{
+				{PodInfo: &mtypes.PodInfo{UID: "pod2", Name: "app-2", NodeId: "node1"}},
+				{PodInfo: nil},
+				nil,
+			},
+			mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+		{
+			name: "readers on other nodes",
+			mountNodes: []*mtypes.Info{
+				{PodInfo: &mtypes.PodInfo{UID: "pod2", Name: "app-2", NodeId: "node2"}},
+			},
+			mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vol := &apis.Volume{Spec: apis.VolumeSpec{Shared: "no", MountNodes: tt.mountNodes}}
+			if err := checkPublishAccessMode(vol, pod, tt.mode); err != nil {
+				t.Errorf("checkPublishAccessMode() error = %v", err)
+			}
+		})
+	}
+}
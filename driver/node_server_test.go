@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"testing"
+)
+
+func Test_abnormalVolumeStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition *csi.VolumeCondition
+		wantMsg   string
+	}{
+		{
+			name:      "volume check found nothing",
+			condition: &csi.VolumeCondition{},
+			wantMsg:   "get block device size of /pods/vol failed: no such device",
+		},
+		{
+			name:      "volume check found the device missing",
+			condition: &csi.VolumeCondition{Abnormal: true, Message: "device /dev/vg/lv is missing"},
+			wantMsg:   "device /dev/vg/lv is missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := abnormalVolumeStats(tt.condition, "get block device size of /pods/vol failed: no such device")
+			if len(got.Usage) != 0 {
+				t.Errorf("abnormalVolumeStats() usage = %v, want empty", got.Usage)
+			}
+			if !got.VolumeCondition.Abnormal {
+				t.Errorf("abnormalVolumeStats() abnormal = false, want true")
+			}
+			if got.VolumeCondition.Message != tt.wantMsg {
+				t.Errorf("abnormalVolumeStats() message = %v, want %v", got.VolumeCondition.Message, tt.wantMsg)
+			}
+		})
+	}
+}
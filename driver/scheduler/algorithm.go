@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"fmt"
+	"qiniu.io/rio-csi/driver/dparams"
+)
+
+// ScoreFunc calc the node score of a scheduling algorithm, the node with higher score is preferred
+type ScoreFunc func(n *NodeView) int64
+
+// scoreFuncs is the score func of the scheduling algorithms supported by the storage class scheduler param
+var scoreFuncs = map[string]ScoreFunc{
+	dparams.VolumeWeighted:   volumeWeightedScore,
+	dparams.CapacityWeighted: capacityWeightedScore,
+	dparams.SpaceWeighted:    spaceWeightedScore,
+}
+
+// getScoreFunc returns the score func of the scheduling algorithm
+func getScoreFunc(algorithm string) (ScoreFunc, error) {
+	scoreFunc, ok := scoreFuncs[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported scheduler %s", algorithm)
+	}
+
+	return scoreFunc, nil
+}
+
+// volumeWeightedScore the less volumes and snapshots are provisioned and pending on the node the score is higher
+func volumeWeightedScore(n *NodeView) int64 {
+	return -(n.VolumeNum + n.PendingVolumeNum + n.SnapshotNum + n.PendingSnapshotNum)
+}
+
+// capacityWeightedScore the less storage is occupied by provisioned and pending volumes and snapshots
+// on the node the score is higher
+func capacityWeightedScore(n *NodeView) int64 {
+	used := n.TotalSize
+	used.Sub(n.TotalFree)
+	return -(used.Value() + n.PendingVolumeSize + n.PendingSnapshotSize)
+}
+
+// spaceWeightedScore the more free storage is left after the pending volumes and snapshots
+// are created on the node the score is higher
+func spaceWeightedScore(n *NodeView) int64 {
+	return n.TotalFree.Value() - n.PendingVolumeSize - n.PendingSnapshotSize
+}
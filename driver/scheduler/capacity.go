@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"qiniu.io/rio-csi/driver/dparams"
+	"qiniu.io/rio-csi/lib/lvm"
+	"qiniu.io/rio-csi/logger"
+)
+
+// GetCapacity reports the capacity of the vgs match the storage class vgpattern, thin volume
+// is allocated from the thin pool by the overcommit ratio
+func (m *Manager) GetCapacity(params *dparams.VolumeParams, topology *csi.Topology) (available, maximum int64, err error) {
+	scheduler, err := m.getScheduler(params.VgPattern.String())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return scheduler.GetCapacity(topology, params.ThinProvision == lvm.YES)
+}
+
+// GetCapacity sums the storage of the vgs after the pending reservations on the nodes which satisfy the topology,
+// all the nodes are counted if topology is empty. maximum is the largest storage of a single vg
+// because a volume can't span over vgs, it's what ScheduleVolume accepts
+func (s *VolumeScheduler) GetCapacity(topology *csi.Topology, thin bool) (available, maximum int64, err error) {
+	var filterNodesMap map[string]bool
+	if topology != nil && len(topology.Segments) > 0 {
+		filterNodesMap, err = filterTopology([]*csi.Topology{topology})
+		if err != nil {
+			logger.StdLog.Errorf("filterTopology %v error %v", topology.Segments, err)
+			return 0, 0, err
+		}
+	}
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.syncPendingReservations()
+
+	for _, node := range s.NodeViewMap {
+		if _, ok := filterNodesMap[node.NodeName]; filterNodesMap != nil && !ok {
+			continue
+		}
+
+		for _, vg := range node.VolumeGroups {
+			vgAvailable := vg.available(thin)
+			if vgAvailable <= 0 {
+				continue
+			}
+
+			available += vgAvailable
+			if vgAvailable > maximum {
+				maximum = vgAvailable
+			}
+		}
+	}
+
+	return available, maximum, nil
+}
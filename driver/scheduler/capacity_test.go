@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/generated/informer/externalversions"
+	"qiniu.io/rio-csi/generated/internalclientset/fake"
+	"testing"
+	"time"
+)
+
+func TestVolumeScheduler_GetCapacity(t *testing.T) {
+	defaultInformer := client.DefaultInformer
+	client.DefaultInformer = externalversions.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	defer func() { client.DefaultInformer = defaultInformer }()
+
+	tests := []struct {
+		name          string
+		thin          bool
+		wantAvailable int64
+		wantMaximum   int64
+	}{
+		{
+			name:          "thick volume",
+			wantAvailable: 90 << 30,
+			wantMaximum:   50 << 30,
+		},
+		{
+			name:          "thin volume",
+			thin:          true,
+			wantAvailable: 250 << 30,
+			wantMaximum:   200 << 30,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &VolumeScheduler{
+				NodeViewMap: map[string]*NodeView{
+					"node1": {NodeName: "node1", VolumeGroups: map[string]*VgView{
+						"riovg1": {Name: "riovg1", Free: resource.MustParse("100Gi"), ThinFree: 300 << 30},
+					}},
+					"node2": {NodeName: "node2", VolumeGroups: map[string]*VgView{
+						"riovg1": {Name: "riovg1", Free: resource.MustParse("40Gi")},
+						"riovg2": {Name: "riovg2", Free: resource.MustParse("10Gi"), ThinFree: 50 << 30},
+					}},
+				},
+				CacheVolumeMap: map[string]*VolumeView{
+					"pvc-1": {Name: "pvc-1", NodeName: "node1", VgName: "riovg1",
+						RequiredStorage: resource.MustParse("50Gi"), ReservedAt: time.Now()},
+					"pvc-2": {Name: "pvc-2", NodeName: "node1", VgName: "riovg1", Thin: true,
+						RequiredStorage: resource.MustParse("100Gi"), ReservedAt: time.Now()},
+				},
+				CacheSnapshotMap: map[string]*SnapshotView{
+					"snap-1": {Name: "snap-1", NodeName: "node2", VgName: "riovg2", RequiredStorage: resource.MustParse("20Gi")},
+				},
+			}
+			available, maximum, err := s.GetCapacity(nil, tt.thin)
+			if err != nil {
+				t.Errorf("GetCapacity() error = %v", err)
+				return
+			}
+			if available != tt.wantAvailable || maximum != tt.wantMaximum {
+				t.Errorf("GetCapacity() got = %v, %v, want %v, %v", available, maximum, tt.wantAvailable, tt.wantMaximum)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"qiniu.io/rio-csi/driver/dparams"
+)
+
+// Explanation is the simulated scheduling result of a volume request, it's used to debug
+// why a volume is scheduled to a node or why it cant be scheduled
+type Explanation struct {
+	VgPattern     string `json:"vg_pattern"`
+	Scheduler     string `json:"scheduler"`
+	RequiredBytes int64  `json:"required_bytes"`
+	Thin          bool   `json:"thin"`
+	// Nodes are the node views sorted by the scheduling order
+	Nodes []*NodeView `json:"nodes"`
+	// Results are the filter results of every node in the scheduling order
+	Results []*FilterResult `json:"results"`
+	// NodeName and VgName are where the volume would be scheduled
+	NodeName string `json:"node_name,omitempty"`
+	VgName   string `json:"vg_name,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ExplainVolume simulates the scheduling of the volume request without reserving any storage,
+// every node is checked so the reason why it's filtered is reported
+func (s *VolumeScheduler) ExplainVolume(req *csi.CreateVolumeRequest, params *dparams.VolumeParams,
+	spread *SpreadConstraint) (*Explanation, error) {
+	filter, err := newNodeFilter(req, params, "", "", spread)
+	if err != nil {
+		return nil, err
+	}
+
+	scoreFunc, err := getScoreFunc(params.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	nodes, results, err := s.filterNodes(filter, params.Scheduler, scoreFunc, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// report the score of every algorithm so that the scheduling of other algorithms can be compared
+	for _, node := range nodes {
+		nodeView := s.NodeViewMap[node.NodeName]
+		for algorithm, f := range scoreFuncs {
+			node.Scores[algorithm] = nodeView.CalcScore(algorithm, f)
+		}
+	}
+
+	explanation := &Explanation{
+		VgPattern:     s.VgPatternStr,
+		Scheduler:     params.Scheduler,
+		Thin:          filter.thin,
+		RequiredBytes: filter.required,
+		Nodes:         nodes,
+		Results:       results,
+	}
+
+	for _, result := range results {
+		if result.Reason == "" {
+			explanation.NodeName = result.NodeName
+			explanation.VgName = result.VgName
+			return explanation, nil
+		}
+	}
+
+	explanation.Error = "cant find a suitable node"
+	return explanation, nil
+}
+
+// ExplainVolume simulates the scheduling of the volume request in the scheduler of its vg pattern
+func (m *Manager) ExplainVolume(req *csi.CreateVolumeRequest, params *dparams.VolumeParams) (*Explanation, error) {
+	spread, err := NewSpreadConstraint(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// explain doesnt create the scheduler of a new vg pattern, it would watch the nodes for nothing
+	vgPatternStr := params.VgPattern.String()
+	m.Lock.Lock()
+	scheduler, ok := m.SchedulerMap[vgPatternStr]
+	m.Lock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: vgpattern %s", ErrSchedulerNotFound, vgPatternStr)
+	}
+
+	return scheduler.ExplainVolume(req, params, spread)
+}
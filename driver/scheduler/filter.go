@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"qiniu.io/rio-csi/driver/dparams"
+	"qiniu.io/rio-csi/lib/lvm"
+)
+
+// nodeFilter filters the nodes which cant hold the volume
+type nodeFilter struct {
+	volName    string
+	required   int64
+	sourceNode string
+	sourceVg   string
+	// thin volume is allocated from the thin pool bounded by the overcommit ratio
+	thin bool
+	// topologyNodes are the nodes satisfy the topology requirement, nil means all the nodes
+	topologyNodes map[string]bool
+	cordonedNodes map[string]bool
+	spread        *SpreadConstraint
+	spreadCount   map[string]int
+}
+
+// FilterResult is the scheduling result of a node
+type FilterResult struct {
+	NodeName string `json:"node_name"`
+	Score    int64  `json:"score"`
+	// VgName is the vg to hold the volume if the node is not filtered
+	VgName string `json:"vg_name,omitempty"`
+	// Reason is why the node is filtered
+	Reason string `json:"reason,omitempty"`
+}
+
+// newNodeFilter builds the node filter of the volume request, the topology and cordoned nodes are listed
+// from kubernetes so it should be called out of the scheduler lock
+func newNodeFilter(req *csi.CreateVolumeRequest, params *dparams.VolumeParams, sourceNode, sourceVg string,
+	spread *SpreadConstraint) (*nodeFilter, error) {
+	topologyNodes, err := filterTopologyRequirement(req.AccessibilityRequirements)
+	if err != nil {
+		return nil, fmt.Errorf("filterTopologyRequirement error %v", err)
+	}
+
+	cordoned, err := cordonedNodes()
+	if err != nil {
+		return nil, fmt.Errorf("list cordoned nodes error %v", err)
+	}
+
+	return &nodeFilter{
+		volName:       req.Name,
+		required:      req.GetCapacityRange().GetRequiredBytes(),
+		sourceNode:    sourceNode,
+		sourceVg:      sourceVg,
+		thin:          params.ThinProvision == lvm.YES,
+		topologyNodes: topologyNodes,
+		cordonedNodes: cordoned,
+		spread:        spread,
+	}, nil
+}
+
+// filterNodes sorts the nodes by the scheduling algorithm and the spread constraint then checks them in order,
+// it stops at the first node which can hold the volume unless all is set. It must be called with the lock held.
+func (s *VolumeScheduler) filterNodes(f *nodeFilter, algorithm string, scoreFunc ScoreFunc, all bool) (
+	nodes []*NodeView, results []*FilterResult, err error) {
+	nodes = s.NodeSort(algorithm, scoreFunc)
+	if f.spread != nil {
+		f.spreadCount, err = s.spreadDomainCount(f.spread, f.volName)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.spread.sortBySpread(f.spreadCount, nodes)
+	}
+
+	for _, node := range nodes {
+		vgName, reason := s.filterNode(f, node)
+		results = append(results, &FilterResult{
+			NodeName: node.NodeName,
+			Score:    node.Score,
+			VgName:   vgName,
+			Reason:   reason,
+		})
+
+		if reason == "" && !all {
+			break
+		}
+	}
+
+	return nodes, results, nil
+}
+
+// filterNode returns the vg of the node to hold the volume, or the reason why the node is filtered
+func (s *VolumeScheduler) filterNode(f *nodeFilter, node *NodeView) (vgName, reason string) {
+	if _, ok := f.topologyNodes[node.NodeName]; f.topologyNodes != nil && !ok {
+		return "", "node doesn't satisfy the topology requirement"
+	}
+
+	if f.cordonedNodes[node.NodeName] {
+		return "", "node is cordoned"
+	}
+
+	if f.sourceNode != "" && node.NodeName != f.sourceNode {
+		return "", fmt.Sprintf("volume must be created on the source node %s", f.sourceNode)
+	}
+
+	if s.isFailedNode(f.volName, node.NodeName) {
+		return "", "volume failed to provision on the node recently"
+	}
+
+	if f.spread != nil && f.spread.Hard {
+		domain := f.spread.domain(node.NodeName)
+		if count := f.spreadCount[domain]; count > 0 {
+			return "", fmt.Sprintf("spread group %s has %d volumes in domain %s", f.spread.Group, count, domain)
+		}
+	}
+
+	vgName, ok := node.PickVolumeGroup(f.required, f.sourceVg, f.thin)
+	if !ok {
+		if f.thin {
+			return "", fmt.Sprintf("no thin pool can fit %d bytes by the overcommit ratio, max available %d bytes",
+				f.required, node.MaxAvailable(f.sourceVg, true))
+		}
+		return "", fmt.Sprintf("no vg can fit %d bytes, max available %d bytes", f.required, node.MaxAvailable(f.sourceVg, false))
+	}
+
+	return vgName, ""
+}
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	"testing"
+	"time"
+)
+
+func TestVolumeScheduler_filterNode(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     *nodeFilter
+		wantVg     string
+		wantReason bool
+	}{
+		{
+			name:   "fit",
+			filter: &nodeFilter{volName: "pvc-1", required: 10 << 30},
+			wantVg: "riovg1",
+		},
+		{
+			name:       "not in topology nodes",
+			filter:     &nodeFilter{volName: "pvc-1", required: 10 << 30, topologyNodes: map[string]bool{"node2": true}},
+			wantReason: true,
+		},
+		{
+			name:   "in topology nodes",
+			filter: &nodeFilter{volName: "pvc-1", required: 10 << 30, topologyNodes: map[string]bool{"node1": true}},
+			wantVg: "riovg1",
+		},
+		{
+			name:       "cordoned",
+			filter:     &nodeFilter{volName: "pvc-1", required: 10 << 30, cordonedNodes: map[string]bool{"node1": true}},
+			wantReason: true,
+		},
+		{
+			name:       "not the source node",
+			filter:     &nodeFilter{volName: "pvc-1", required: 10 << 30, sourceNode: "node2"},
+			wantReason: true,
+		},
+		{
+			name:       "failed recently",
+			filter:     &nodeFilter{volName: "pvc-failed", required: 10 << 30},
+			wantReason: true,
+		},
+		{
+			name: "hard spread domain taken",
+			filter: &nodeFilter{volName: "pvc-1", required: 10 << 30,
+				spread: &SpreadConstraint{Group: "db", Hard: true}, spreadCount: map[string]int{"node1": 1}},
+			wantReason: true,
+		},
+		{
+			name: "soft spread domain taken",
+			filter: &nodeFilter{volName: "pvc-1", required: 10 << 30,
+				spread: &SpreadConstraint{Group: "db"}, spreadCount: map[string]int{"node1": 1}},
+			wantVg: "riovg1",
+		},
+		{
+			name:       "no vg can fit",
+			filter:     &nodeFilter{volName: "pvc-1", required: 100 << 30},
+			wantReason: true,
+		},
+		{
+			name:   "thin pool",
+			filter: &nodeFilter{volName: "pvc-1", required: 100 << 30, thin: true},
+			wantVg: "riovg1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &VolumeScheduler{FailedNodeMap: map[string]map[string]time.Time{"pvc-failed": {"node1": time.Now()}}}
+			node := &NodeView{
+				NodeName: "node1",
+				VolumeGroups: map[string]*VgView{
+					"riovg1": {Name: "riovg1", Free: resource.MustParse("50Gi"), ThinFree: 200 << 30},
+				},
+			}
+			vgName, reason := s.filterNode(tt.filter, node)
+			if vgName != tt.wantVg || (reason != "") != tt.wantReason {
+				t.Errorf("filterNode() got = %v, %q, want %v, reason %v", vgName, reason, tt.wantVg, tt.wantReason)
+			}
+		})
+	}
+}
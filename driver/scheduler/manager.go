@@ -1,7 +1,9 @@
 package scheduler
 
 import (
+	"fmt"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	apis "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/driver/dparams"
 	"sync"
 )
@@ -17,23 +19,81 @@ func NewManager() *Manager {
 	}
 }
 
-// ScheduleVolume volume to a specific node
-// TODO support multi Vg allocate
-func (m *Manager) ScheduleVolume(req *csi.CreateVolumeRequest, params *dparams.VolumeParams) (nodeName string, err error) {
-	vgPatternStr := params.VgPattern.String()
-
+// getScheduler returns the scheduler of the vg pattern, it's created at the first use
+func (m *Manager) getScheduler(vgPatternStr string) (*VolumeScheduler, error) {
 	m.Lock.Lock()
+	defer m.Lock.Unlock()
+
 	scheduler, ok := m.SchedulerMap[vgPatternStr]
 	if !ok {
+		var err error
 		scheduler, err = NewVolumeScheduler(vgPatternStr)
 		if err != nil {
-			m.Lock.Unlock()
-			return "", err
+			return nil, err
 		}
 
 		m.SchedulerMap[vgPatternStr] = scheduler
 	}
+
+	return scheduler, nil
+}
+
+// ScheduleVolume volume to a specific node and volume group
+// if sourceNode and sourceVg are not empty the volume can only be scheduled to them,
+// it's used by volumes cloned from a snapshot or another volume
+func (m *Manager) ScheduleVolume(req *csi.CreateVolumeRequest, params *dparams.VolumeParams, sourceNode, sourceVg string) (nodeName, vgName string, err error) {
+	vgPatternStr := params.VgPattern.String()
+
+	spread, err := NewSpreadConstraint(params)
+	if err != nil {
+		return "", "", err
+	}
+
+	scheduler, err := m.getScheduler(vgPatternStr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return scheduler.ScheduleVolume(req, params, sourceNode, sourceVg, spread)
+}
+
+// UnscheduleVolume release the volume storage reserved in all schedulers
+func (m *Manager) UnscheduleVolume(name string) {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	for _, scheduler := range m.SchedulerMap {
+		scheduler.UnscheduleVolume(name)
+	}
+}
+
+// ScheduleSnapshot reserve the snapshot cow space from the owner node volume group
+func (m *Manager) ScheduleSnapshot(snap *apis.Snapshot) error {
+	vgPatternStr := snap.Spec.VgPattern
+	if vgPatternStr == "" {
+		vgPatternStr = fmt.Sprintf("^%v$", snap.Spec.VolGroup)
+	}
+
+	scheduler, err := m.getScheduler(vgPatternStr)
+	if err != nil {
+		return err
+	}
+
+	// the volumes of every vg pattern may be pending on the snapshot vg
+	var pendingVolumeSize int64
+	m.Lock.Lock()
+	for _, s := range m.SchedulerMap {
+		pendingVolumeSize += s.pendingVolumeSize(snap.Spec.OwnerNodeID, snap.Spec.VolGroup)
+	}
 	m.Lock.Unlock()
 
-	return scheduler.ScheduleVolume(req)
+	return scheduler.ScheduleSnapshot(snap, pendingVolumeSize)
+}
+
+// UnscheduleSnapshot release the snapshot cow space reserved in all schedulers
+func (m *Manager) UnscheduleSnapshot(name string) {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	for _, scheduler := range m.SchedulerMap {
+		scheduler.UnscheduleSnapshot(name)
+	}
 }
@@ -3,7 +3,7 @@ package scheduler
 import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	apis "qiniu.io/rio-csi/api/rio/v1"
-	"qiniu.io/rio-csi/utils"
+	"qiniu.io/rio-csi/lib/lvm"
 	"regexp"
 )
 
@@ -19,11 +19,51 @@ type NodeView struct {
 	TotalFree           resource.Quantity `json:"total_free"`
 	MaxFree             resource.Quantity `json:"max_free"`
 	Score               int64             `json:"score"`
+	// Scores is the cached score of every scheduling algorithm, it's invalidated
+	// when the node or the reservations on it are changed
+	Scores map[string]int64 `json:"scores"`
+	// VolumeGroups is the view of the vgs match the vg pattern on the node
+	VolumeGroups map[string]*VgView `json:"volume_groups"`
+}
+
+// VgView is the free storage and pending reservations of a volume group on the node
+type VgView struct {
+	Name                string            `json:"name"`
+	Size                resource.Quantity `json:"size"`
+	Free                resource.Quantity `json:"free"`
+	LVCount             int64             `json:"lv_count"`
+	SnapCount           int64             `json:"snap_count"`
+	PendingVolumeSize   int64             `json:"pending_volume_size"`   // byte
+	PendingSnapshotSize int64             `json:"pending_snapshot_size"` // byte
+	// ThinFree is the total size of the thin volumes can be created in the thin pool by the overcommit ratio
+	ThinFree        int64 `json:"thin_free"`
+	PendingThinSize int64 `json:"pending_thin_size"` // byte
+}
+
+// Available returns the free storage of the vg which is not reserved by the pending volumes and snapshots
+func (v *VgView) Available() int64 {
+	return v.Free.Value() - v.PendingVolumeSize - v.PendingSnapshotSize
+}
+
+// ThinAvailable returns the size of the thin volumes can be created in the thin pool of the vg
+// which is not reserved by the pending thin volumes
+func (v *VgView) ThinAvailable() int64 {
+	return v.ThinFree - v.PendingThinSize
+}
+
+// available returns the storage of the vg for the thin or thick volume
+func (v *VgView) available(thin bool) int64 {
+	if thin {
+		return v.ThinAvailable()
+	}
+
+	return v.Available()
 }
 
 func NewNodeView(n *apis.RioNode, vgPattern *regexp.Regexp) *NodeView {
 	nodeView := &NodeView{
-		NodeName: n.Name,
+		NodeName:     n.Name,
+		VolumeGroups: make(map[string]*VgView),
 	}
 
 	maxFree := resource.Quantity{}
@@ -36,6 +76,15 @@ func NewNodeView(n *apis.RioNode, vgPattern *regexp.Regexp) *NodeView {
 			if maxFree.Cmp(vg.Free) < 0 {
 				maxFree = vg.Free
 			}
+
+			nodeView.VolumeGroups[vg.Name] = &VgView{
+				Name:      vg.Name,
+				Size:      vg.Size,
+				Free:      vg.Free,
+				LVCount:   int64(vg.LVCount),
+				SnapCount: int64(vg.SnapCount),
+				ThinFree:  lvm.ThinAvailable(vg),
+			}
 		}
 	}
 	nodeView.MaxFree = maxFree
@@ -48,27 +97,142 @@ func (n *NodeView) ClearCacheData() {
 	n.PendingVolumeSize = 0
 	n.PendingSnapshotNum = 0
 	n.PendingSnapshotSize = 0
+	for _, vg := range n.VolumeGroups {
+		vg.PendingVolumeSize = 0
+		vg.PendingSnapshotSize = 0
+		vg.PendingThinSize = 0
+	}
+}
+
+// AddPendingVolume reserves the storage of the pending volume on the node and its vg
+func (n *NodeView) AddPendingVolume(v *VolumeView) {
+	n.PendingVolumeNum = n.PendingVolumeNum + 1
+	n.PendingVolumeSize = n.PendingVolumeSize + v.RequiredStorage.Value()
+	if vg, ok := n.VolumeGroups[v.VgName]; ok {
+		// the thin volume is allocated from the thin pool instead of the vg free space
+		if v.Thin {
+			vg.PendingThinSize = vg.PendingThinSize + v.RequiredStorage.Value()
+		} else {
+			vg.PendingVolumeSize = vg.PendingVolumeSize + v.RequiredStorage.Value()
+		}
+	}
+}
+
+// AddPendingSnapshot reserves the storage of the pending snapshot on the node and its vg
+func (n *NodeView) AddPendingSnapshot(v *SnapshotView) {
+	n.PendingSnapshotNum = n.PendingSnapshotNum + 1
+	n.PendingSnapshotSize = n.PendingSnapshotSize + v.RequiredStorage.Value()
+	if vg, ok := n.VolumeGroups[v.VgName]; ok {
+		vg.PendingSnapshotSize = vg.PendingSnapshotSize + v.RequiredStorage.Value()
+	}
+}
+
+// PickVolumeGroup returns the vg which can fit the required storage after the pending reservations,
+// the vg having least available storage is preferred to keep large vgs for large volumes.
+// if vgName is not empty only it will be considered, if thin is true the thin pool storage is checked
+func (n *NodeView) PickVolumeGroup(required int64, vgName string, thin bool) (string, bool) {
+	var picked *VgView
+	for _, vg := range n.VolumeGroups {
+		if vgName != "" && vg.Name != vgName {
+			continue
+		}
+
+		if vg.available(thin) <= required {
+			continue
+		}
+
+		if picked == nil || vg.available(thin) < picked.available(thin) ||
+			(vg.available(thin) == picked.available(thin) && vg.Name < picked.Name) {
+			picked = vg
+		}
+	}
+
+	if picked == nil {
+		return "", false
+	}
+
+	return picked.Name, true
+}
+
+// MaxAvailable returns the max available storage of the vgs after the pending reservations,
+// if vgName is not empty only it will be considered, if thin is true the thin pool storage is checked
+func (n *NodeView) MaxAvailable(vgName string, thin bool) int64 {
+	var maxAvailable int64
+	for _, vg := range n.VolumeGroups {
+		if vgName != "" && vg.Name != vgName {
+			continue
+		}
+
+		if vg.available(thin) > maxAvailable {
+			maxAvailable = vg.available(thin)
+		}
+	}
+
+	return maxAvailable
+}
+
+// DeepCopy returns a copy of the node view
+func (n *NodeView) DeepCopy() *NodeView {
+	node := &NodeView{
+		NodeName:            n.NodeName,
+		VolumeNum:           n.VolumeNum,
+		SnapshotNum:         n.SnapshotNum,
+		PendingVolumeNum:    n.PendingVolumeNum,
+		PendingVolumeSize:   n.PendingVolumeSize,
+		PendingSnapshotNum:  n.PendingSnapshotNum,
+		PendingSnapshotSize: n.PendingSnapshotSize,
+		TotalSize:           n.TotalSize.DeepCopy(),
+		TotalFree:           n.TotalFree.DeepCopy(),
+		MaxFree:             n.MaxFree.DeepCopy(),
+		Score:               n.Score,
+		Scores:              make(map[string]int64, len(n.Scores)),
+		VolumeGroups:        make(map[string]*VgView, len(n.VolumeGroups)),
+	}
+
+	for algorithm, score := range n.Scores {
+		node.Scores[algorithm] = score
+	}
+
+	for name, vg := range n.VolumeGroups {
+		vgCopy := *vg
+		vgCopy.Size = vg.Size.DeepCopy()
+		vgCopy.Free = vg.Free.DeepCopy()
+		node.VolumeGroups[name] = &vgCopy
+	}
+
+	return node
+}
+
+// CalcScore calc node score by the scheduling algorithm, the cached score of the algorithm
+// is used until the node view is invalidated
+func (n *NodeView) CalcScore(algorithm string, scoreFunc ScoreFunc) int64 {
+	if n.Scores == nil {
+		n.Scores = make(map[string]int64)
+	}
+
+	score, ok := n.Scores[algorithm]
+	if !ok {
+		score = scoreFunc(n)
+		n.Scores[algorithm] = score
+	}
+
+	return score
+}
+
+// InvalidateScores drops the cached scores of all algorithms
+func (n *NodeView) InvalidateScores() {
+	n.Scores = nil
+}
+
+// invalidateNodeScores drops the cached scores of the node whose reservations are changed,
+// it must be called with the lock held
+func (s *VolumeScheduler) invalidateNodeScores(nodeName string) {
+	if node, ok := s.NodeViewMap[nodeName]; ok {
+		node.InvalidateScores()
+	}
 }
 
-// CalcScore calc node score used storage weight is -1 free storage weight 1
-// volume Num weight is -1 * 100 Gi, snapshot Num is -1 * 100 Gi
-// the more lv num the score is lower
-// the more free disk storage the score is higher
-// the more usage disk storage the score is lower
-func (n *NodeView) CalcScore() {
-	used := n.TotalSize
-	used.Sub(n.TotalFree)
-	free := n.TotalFree
-	free.Sub(used)
-	score := free.Value() - n.PendingSnapshotSize - n.PendingVolumeSize
-	score = score - 100*utils.Gi*n.VolumeNum
-	score = score - 100*utils.Gi*n.SnapshotNum
-	score = score - 100*utils.Gi*n.PendingVolumeNum
-	score = score - 100*utils.Gi*n.PendingSnapshotNum
-	n.Score = score
-}
-
-// SyncNodeView Sync NodeView cache TODO support more algorithm
+// SyncNodeView Sync NodeView cache
 func (s *VolumeScheduler) SyncNodeView(nodes []*apis.RioNode) {
 	for _, n := range nodes {
 		s.NodeViewMap[n.Name] = NewNodeView(n, s.VgPattern)
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	"testing"
+)
+
+func TestNodeView_PickVolumeGroup(t *testing.T) {
+	node := &NodeView{
+		NodeName: "node1",
+		VolumeGroups: map[string]*VgView{
+			"riovg1": {Name: "riovg1", Free: resource.MustParse("100Gi"), PendingVolumeSize: 50 << 30, ThinFree: 300 << 30},
+			"riovg2": {Name: "riovg2", Free: resource.MustParse("80Gi"), PendingSnapshotSize: 10 << 30, ThinFree: 100 << 30},
+			"riovg3": {Name: "riovg3", Free: resource.MustParse("50Gi"), ThinFree: 200 << 30, PendingThinSize: 100 << 30},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		required int64
+		vgName   string
+		thin     bool
+		want     string
+		wantOk   bool
+	}{
+		{
+			name:     "least available vg is preferred",
+			required: 20 << 30,
+			want:     "riovg1",
+			wantOk:   true,
+		},
+		{
+			name:     "tie broken by name",
+			required: 40 << 30,
+			want:     "riovg1",
+			wantOk:   true,
+		},
+		{
+			name:     "pending reservations are excluded",
+			required: 60 << 30,
+			want:     "riovg2",
+			wantOk:   true,
+		},
+		{
+			name:     "no vg can fit",
+			required: 70 << 30,
+			wantOk:   false,
+		},
+		{
+			name:     "only the specified vg",
+			required: 20 << 30,
+			vgName:   "riovg2",
+			want:     "riovg2",
+			wantOk:   true,
+		},
+		{
+			name:     "thin pool",
+			required: 100 << 30,
+			thin:     true,
+			want:     "riovg1",
+			wantOk:   true,
+		},
+		{
+			name:     "thin pool tie broken by name",
+			required: 50 << 30,
+			thin:     true,
+			want:     "riovg2",
+			wantOk:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := node.PickVolumeGroup(tt.required, tt.vgName, tt.thin)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("PickVolumeGroup() got = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
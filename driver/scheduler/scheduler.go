@@ -1,16 +1,28 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
 	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/driver/dparams"
 	"qiniu.io/rio-csi/logger"
 	"regexp"
 	"sort"
 	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSuitableNode means no node can fit the volume capacity, topology or spread requirement
+	ErrNoSuitableNode = errors.New("cant find a suitable node")
+	// ErrSourceNodeUnfit means the source node of the cloned volume cant fit it
+	ErrSourceNodeUnfit = errors.New("source node cant fit the volume")
+	// ErrSchedulerNotFound means no volume or snapshot of the vg pattern has been scheduled yet
+	ErrSchedulerNotFound = errors.New("scheduler not found")
 )
 
 type VolumeScheduler struct {
@@ -21,7 +33,9 @@ type VolumeScheduler struct {
 	CacheVolumeMap map[string]*VolumeView
 	// CacheSnapshotMap to record Snapshot which didn't success to create
 	CacheSnapshotMap map[string]*SnapshotView
-	Lock             sync.Mutex
+	// FailedNodeMap to record nodes where the volume failed to provision
+	FailedNodeMap map[string]map[string]time.Time
+	Lock          sync.Mutex
 }
 
 func NewVolumeScheduler(vgPatternStr string) (s *VolumeScheduler, err error) {
@@ -30,6 +44,7 @@ func NewVolumeScheduler(vgPatternStr string) (s *VolumeScheduler, err error) {
 		NodeViewMap:      make(map[string]*NodeView),
 		CacheVolumeMap:   make(map[string]*VolumeView),
 		CacheSnapshotMap: make(map[string]*SnapshotView),
+		FailedNodeMap:    make(map[string]map[string]time.Time),
 	}
 
 	if s.VgPattern, err = regexp.Compile(s.VgPatternStr); err != nil {
@@ -65,7 +80,7 @@ func NewVolumeScheduler(vgPatternStr string) (s *VolumeScheduler, err error) {
 func (s *VolumeScheduler) Sync() error {
 	nodes, err := client.DefaultInformer.Rio().V1().RioNodes().Lister().List(labels.Everything())
 	if err != nil {
-		logger.StdLog.Errorf("list node error", err)
+		logger.StdLog.Errorf("list node error %v", err)
 		return err
 	}
 
@@ -75,7 +90,7 @@ func (s *VolumeScheduler) Sync() error {
 
 	volumes, err := client.DefaultInformer.Rio().V1().Volumes().Lister().List(labels.Everything())
 	if err != nil {
-		logger.StdLog.Errorf("list node error", err)
+		logger.StdLog.Errorf("list volume error %v", err)
 		return err
 	}
 	logger.StdLog.Infof("get volume list %d", len(volumes))
@@ -84,7 +99,7 @@ func (s *VolumeScheduler) Sync() error {
 
 	snapshots, err := client.DefaultInformer.Rio().V1().Snapshots().Lister().List(labels.Everything())
 	if err != nil {
-		logger.StdLog.Errorf("list node error", err)
+		logger.StdLog.Errorf("list snapshot error %v", err)
 		return err
 	}
 	logger.StdLog.Infof("get snapshot list %d", len(snapshots))
@@ -94,42 +109,67 @@ func (s *VolumeScheduler) Sync() error {
 
 }
 
-// ScheduleVolume volume to a specific node
-// TODO support multi Vg allocate
-func (s *VolumeScheduler) ScheduleVolume(req *csi.CreateVolumeRequest) (nodeName string, err error) {
-	filterNodesMap, err := filterTopologyRequirement(req.AccessibilityRequirements)
+// ScheduleVolume volume to a specific node and volume group
+// if sourceNode is not empty only the sourceNode will be considered,
+// if sourceVg is not empty only the sourceVg will be considered
+// if spread is not nil the volumes of the spread group are spread across nodes or topology domains
+func (s *VolumeScheduler) ScheduleVolume(req *csi.CreateVolumeRequest, params *dparams.VolumeParams, sourceNode, sourceVg string,
+	spread *SpreadConstraint) (nodeName, vgName string, err error) {
+	filter, err := newNodeFilter(req, params, sourceNode, sourceVg, spread)
+	if err != nil {
+		logger.StdLog.Errorf("newNodeFilter %v", err)
+		return "", "", err
+	}
+
+	scoreFunc, err := getScoreFunc(params.Scheduler)
 	if err != nil {
-		logger.StdLog.Errorf("filterTopologyRequirement %v", err)
-		return
+		return "", "", err
 	}
 
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
 
-	sortNodes := s.NodeSort(req)
+	_, results, err := s.filterNodes(filter, params.Scheduler, scoreFunc, false)
+	if err != nil {
+		return "", "", err
+	}
 
-	for _, node := range sortNodes {
-		if _, ok := filterNodesMap[node.NodeName]; filterNodesMap != nil && !ok {
+	for _, result := range results {
+		if result.Reason != "" {
 			continue
 		}
 
-		requiredStorage := resource.NewQuantity(req.CapacityRange.RequiredBytes, resource.BinarySI)
-		if node.MaxFree.Cmp(*requiredStorage) > 0 {
-			// cache pending volume data
-			s.CacheVolumeMap[req.Name] = &VolumeView{
-				Name:            req.Name,
-				NodeName:        node.NodeName,
-				RequiredStorage: *requiredStorage,
-			}
-			return node.NodeName, nil
+		// cache pending volume data
+		requiredStorage := resource.NewQuantity(filter.required, resource.BinarySI)
+		s.CacheVolumeMap[req.Name] = &VolumeView{
+			Name:            req.Name,
+			NodeName:        result.NodeName,
+			RequiredStorage: *requiredStorage,
+			VgName:          result.VgName,
+			SpreadGroup:     spread.group(),
+			Thin:            filter.thin,
+			ReservedAt:      time.Now(),
 		}
+		s.invalidateNodeScores(result.NodeName)
+		return result.NodeName, result.VgName, nil
+	}
+
+	if sourceNode != "" {
+		return "", "", fmt.Errorf("%w: node %s vg %s cant fit the volume or topology requirement", ErrSourceNodeUnfit, sourceNode, sourceVg)
 	}
 
-	return "", fmt.Errorf("cant find a suitable node")
+	if spread != nil && spread.Hard {
+		return "", "", fmt.Errorf("%w apart from the volumes of spread group %s", ErrNoSuitableNode, spread.Group)
+	}
+
+	return "", "", ErrNoSuitableNode
 }
 
-// NodeSort calc node score and sort at desc
-func (s *VolumeScheduler) NodeSort(req *csi.CreateVolumeRequest) (nodes []*NodeView) {
+// syncPendingReservations recalculates the pending volumes and snapshots of the node views,
+// it must be called with the lock held
+func (s *VolumeScheduler) syncPendingReservations() {
+	s.expireVolumeReservations()
+
 	// clear caching data
 	for _, node := range s.NodeViewMap {
 		node.ClearCacheData()
@@ -137,39 +177,35 @@ func (s *VolumeScheduler) NodeSort(req *csi.CreateVolumeRequest) (nodes []*NodeV
 
 	// recalculate caching data
 	for _, v := range s.CacheVolumeMap {
-		s.NodeViewMap[v.NodeName].PendingVolumeNum = s.NodeViewMap[v.NodeName].PendingVolumeNum + 1
-		s.NodeViewMap[v.NodeName].PendingVolumeSize = s.NodeViewMap[v.NodeName].PendingVolumeSize + v.RequiredStorage.Value()
+		if node, ok := s.NodeViewMap[v.NodeName]; ok {
+			node.AddPendingVolume(v)
+		}
 	}
 
 	for _, v := range s.CacheSnapshotMap {
-		s.NodeViewMap[v.NodeName].PendingSnapshotNum = s.NodeViewMap[v.NodeName].PendingSnapshotNum + 1
-		s.NodeViewMap[v.NodeName].PendingSnapshotSize = s.NodeViewMap[v.NodeName].PendingSnapshotSize + v.RequiredStorage.Value()
+		if node, ok := s.NodeViewMap[v.NodeName]; ok {
+			node.AddPendingSnapshot(v)
+		}
 	}
+}
+
+// NodeSort calc node score by the scheduling algorithm and sort at desc
+func (s *VolumeScheduler) NodeSort(algorithm string, scoreFunc ScoreFunc) (nodes []*NodeView) {
+	s.syncPendingReservations()
 
 	// recalculate node view score
-	nodes = make([]*NodeView, len(s.NodeViewMap))
-	index := 0
+	nodes = make([]*NodeView, 0, len(s.NodeViewMap))
 	for _, node := range s.NodeViewMap {
-		node.CalcScore()
+		node.Score = node.CalcScore(algorithm, scoreFunc)
 		// deep copy to result
-		nodes[index] = &NodeView{
-			NodeName:            node.NodeName,
-			VolumeNum:           node.VolumeNum,
-			SnapshotNum:         node.SnapshotNum,
-			PendingVolumeNum:    node.PendingVolumeNum,
-			PendingVolumeSize:   node.PendingVolumeSize,
-			PendingSnapshotNum:  node.PendingSnapshotNum,
-			PendingSnapshotSize: node.PendingSnapshotSize,
-			TotalSize:           node.TotalSize,
-			TotalFree:           node.TotalFree,
-			MaxFree:             node.MaxFree,
-			Score:               node.Score,
-		}
-		index++
+		nodes = append(nodes, node.DeepCopy())
 	}
 
 	// sort the filtered node map
 	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Score == nodes[j].Score {
+			return nodes[i].NodeName < nodes[j].NodeName
+		}
 		return nodes[i].Score > nodes[j].Score
 	})
 
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/driver/dparams"
+	"qiniu.io/rio-csi/generated/informer/externalversions"
+	"qiniu.io/rio-csi/generated/internalclientset/fake"
+	"testing"
+)
+
+func TestVolumeScheduler_NodeSort(t *testing.T) {
+	defaultInformer := client.DefaultInformer
+	client.DefaultInformer = externalversions.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	defer func() { client.DefaultInformer = defaultInformer }()
+
+	s := &VolumeScheduler{
+		VgPatternStr: "riovg.*",
+		NodeViewMap: map[string]*NodeView{
+			"node1": {NodeName: "node1", VolumeNum: 5},
+			"node2": {NodeName: "node2", VolumeNum: 2},
+		},
+		CacheVolumeMap:   map[string]*VolumeView{},
+		CacheSnapshotMap: map[string]*SnapshotView{},
+	}
+	scoreFunc := scoreFuncs[dparams.VolumeWeighted]
+
+	sortedNames := func() []string {
+		var names []string
+		for _, node := range s.NodeSort(dparams.VolumeWeighted, scoreFunc) {
+			names = append(names, node.NodeName)
+		}
+		return names
+	}
+
+	if got := sortedNames(); got[0] != "node2" {
+		t.Errorf("NodeSort() got = %v, want node2 first", got)
+	}
+
+	// the cached score is used until the node view is invalidated
+	s.NodeViewMap["node2"].VolumeNum = 10
+	if got := sortedNames(); got[0] != "node2" {
+		t.Errorf("NodeSort() with cached score got = %v, want node2 first", got)
+	}
+	if got := s.NodeViewMap["node2"].Scores[dparams.VolumeWeighted]; got != -2 {
+		t.Errorf("cached score got = %v, want %v", got, -2)
+	}
+
+	// reserving a pending volume on node2 invalidates its cached scores
+	s.addVolume(&apis.Volume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+		Spec:       apis.VolumeSpec{VgPattern: "riovg.*", OwnerNodeID: "node2", Capacity: "1073741824"},
+		Status:     apis.VolumeStatus{State: crd.StatusPending},
+	})
+	if got := sortedNames(); got[0] != "node1" {
+		t.Errorf("NodeSort() after reservation got = %v, want node1 first", got)
+	}
+	if got := s.NodeViewMap["node2"].Scores[dparams.VolumeWeighted]; got != -11 {
+		t.Errorf("score after reservation got = %v, want %v", got, -11)
+	}
+
+	// the scores of other algorithms are cached separately
+	s.NodeSort(dparams.SpaceWeighted, scoreFuncs[dparams.SpaceWeighted])
+	if got := len(s.NodeViewMap["node2"].Scores); got != 2 {
+		t.Errorf("cached algorithms got = %v, want %v", got, 2)
+	}
+}
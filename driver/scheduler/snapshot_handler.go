@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"k8s.io/client-go/tools/cache"
 	apis "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/logger"
@@ -24,12 +25,24 @@ func (s *VolumeScheduler) updateSnapshot(oldObj, newObj interface{}) {
 		if snap, ok := s.CacheSnapshotMap[newSnapshot.Name]; ok {
 			snap.IsCreated = true
 		}
+	case crd.StatusFailed:
+		// the failed snapshot has reserved nothing
+		s.UnscheduleSnapshot(newSnapshot.Name)
 	}
 
 }
 
 func (s *VolumeScheduler) deleteSnapshot(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	snap, ok := SnapshotStructuredObject(obj)
+	if !ok {
+		return
+	}
 
+	s.UnscheduleSnapshot(snap.Name)
 }
 
 // SnapshotStructuredObject get Obj from queue is not readily in lvmnode type. This function would convert obj into lvmnode type.
@@ -1,8 +1,10 @@
 package scheduler
 
 import (
+	"fmt"
 	"k8s.io/apimachinery/pkg/api/resource"
 	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/client"
 	"qiniu.io/rio-csi/crd"
 	"strconv"
 )
@@ -15,23 +17,91 @@ type SnapshotView struct {
 	IsCreated       bool              `json:"is_created"`
 }
 
+// NewSnapshotView build the snapshot view, thin snapshot has no snap size and requires no vg storage
+func NewSnapshotView(snap *apis.Snapshot) *SnapshotView {
+	storageSize, _ := strconv.ParseInt(snap.Spec.SnapSize, 10, 64)
+	storage := resource.NewQuantity(storageSize, resource.BinarySI)
+	return &SnapshotView{
+		Name:            snap.Name,
+		NodeName:        snap.Spec.OwnerNodeID,
+		RequiredStorage: *storage,
+		VgName:          snap.Spec.VolGroup,
+		IsCreated:       false,
+	}
+}
+
 func (s *VolumeScheduler) SyncSnapshotView(snapshots []*apis.Snapshot) {
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
 	for _, snap := range snapshots {
-		if (snap.Spec.VgPattern != "" && snap.Spec.VgPattern == s.VgPatternStr) || s.VgPattern.MatchString(snap.Spec.VolGroup) {
+		if s.matchSnapshot(snap) {
 			switch snap.Status.State {
 			case crd.StatusPending:
-				storageSize, _ := strconv.ParseInt(snap.Spec.SnapSize, 10, 64)
-				storage := resource.NewQuantity(storageSize, resource.BinarySI)
-				s.CacheSnapshotMap[snap.Name] = &SnapshotView{
-					Name:            snap.Name,
-					NodeName:        snap.Spec.OwnerNodeID,
-					RequiredStorage: *storage,
-					VgName:          snap.Spec.VolGroup,
-					IsCreated:       false,
-				}
+				s.CacheSnapshotMap[snap.Name] = NewSnapshotView(snap)
+				s.invalidateNodeScores(snap.Spec.OwnerNodeID)
 			}
 		}
 	}
 }
+
+// ScheduleSnapshot checks the owner node volume group has enough free storage
+// for the snapshot reserve and caches the pending snapshot, pendingVolumeSize is the
+// storage of the volume group reserved by the pending thick volumes
+func (s *VolumeScheduler) ScheduleSnapshot(snap *apis.Snapshot, pendingVolumeSize int64) error {
+	view := NewSnapshotView(snap)
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if view.RequiredStorage.Value() > 0 {
+		node, err := client.DefaultInformer.Rio().V1().RioNodes().Lister().RioNodes(crd.RioNamespace).Get(view.NodeName)
+		if err != nil {
+			return fmt.Errorf("cant get node %s: %v", view.NodeName, err)
+		}
+
+		var free *resource.Quantity
+		for _, vg := range node.VolumeGroups {
+			if vg.Name == view.VgName {
+				vgFree := vg.Free.DeepCopy()
+				free = &vgFree
+				break
+			}
+		}
+
+		if free == nil {
+			return fmt.Errorf("volume group %s not found on node %s", view.VgName, view.NodeName)
+		}
+
+		// subtract the storage reserved by the volumes and snapshots which are not created yet
+		free.Sub(*resource.NewQuantity(pendingVolumeSize, resource.BinarySI))
+		for _, v := range s.CacheSnapshotMap {
+			if v.Name != view.Name && v.NodeName == view.NodeName && v.VgName == view.VgName && !v.IsCreated {
+				free.Sub(v.RequiredStorage)
+			}
+		}
+
+		if free.Cmp(view.RequiredStorage) < 0 {
+			return fmt.Errorf("volume group %s on node %s has %s free storage, cant reserve %s for snapshot %s",
+				view.VgName, view.NodeName, free.String(), view.RequiredStorage.String(), view.Name)
+		}
+	}
+
+	s.CacheSnapshotMap[view.Name] = view
+	s.invalidateNodeScores(view.NodeName)
+	return nil
+}
+
+// UnscheduleSnapshot remove the snapshot from cache
+func (s *VolumeScheduler) UnscheduleSnapshot(name string) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if v, ok := s.CacheSnapshotMap[name]; ok {
+		delete(s.CacheSnapshotMap, name)
+		s.invalidateNodeScores(v.NodeName)
+	}
+}
+
+// matchSnapshot returns whether the snapshot is allocated from the volume groups of the scheduler
+func (s *VolumeScheduler) matchSnapshot(snap *apis.Snapshot) bool {
+	return (snap.Spec.VgPattern != "" && snap.Spec.VgPattern == s.VgPatternStr) || s.VgPattern.MatchString(snap.Spec.VolGroup)
+}
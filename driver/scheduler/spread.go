@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/driver/dparams"
+	"sort"
+)
+
+// SpreadConstraint spreads the volumes of the same group across distinct owner nodes or topology domains
+type SpreadConstraint struct {
+	Group string
+	Hard  bool
+	// NodeDomains maps the node to its topology domain, every node is a domain itself if it's nil
+	NodeDomains map[string]string
+}
+
+// NewSpreadConstraint returns the spread constraint of the volume params, it's nil if no spread group is set
+func NewSpreadConstraint(params *dparams.VolumeParams) (*SpreadConstraint, error) {
+	if params.SpreadGroup == "" {
+		return nil, nil
+	}
+
+	c := &SpreadConstraint{
+		Group: params.SpreadGroup,
+		Hard:  params.SpreadMode == dparams.SpreadModeHard,
+	}
+
+	if params.SpreadTopologyKey != "" {
+		nodeDomains, err := nodeTopologyDomains(params.SpreadTopologyKey)
+		if err != nil {
+			return nil, err
+		}
+		c.NodeDomains = nodeDomains
+	}
+
+	return c, nil
+}
+
+// group returns the spread group, it's empty if there is no spread constraint
+func (c *SpreadConstraint) group() string {
+	if c == nil {
+		return ""
+	}
+
+	return c.Group
+}
+
+// domain returns the topology domain of the node, the node without the topology label is a domain itself
+func (c *SpreadConstraint) domain(nodeName string) string {
+	if domain, ok := c.NodeDomains[nodeName]; ok {
+		return domain
+	}
+
+	return nodeName
+}
+
+// spreadDomainCount counts the volumes of the spread group in every topology domain, the volumes
+// created are listed by the informer and the volumes just scheduled are in the cache
+func (s *VolumeScheduler) spreadDomainCount(c *SpreadConstraint, volName string) (map[string]int, error) {
+	volumes, err := client.DefaultInformer.Rio().V1().Volumes().Lister().
+		List(labels.SelectorFromSet(labels.Set{crd.SpreadGroupKey: c.Group}))
+	if err != nil {
+		return nil, err
+	}
+
+	volumeNodes := make(map[string]string)
+	for _, volume := range volumes {
+		// failed volume will be rescheduled
+		if volume.Name == volName || volume.GetDeletionTimestamp() != nil || volume.Status.State == crd.StatusFailed {
+			continue
+		}
+		volumeNodes[volume.Name] = volume.Spec.OwnerNodeID
+	}
+
+	for _, v := range s.CacheVolumeMap {
+		if v.Name != volName && v.SpreadGroup == c.Group {
+			volumeNodes[v.Name] = v.NodeName
+		}
+	}
+
+	domainCount := make(map[string]int)
+	for _, nodeName := range volumeNodes {
+		domainCount[c.domain(nodeName)]++
+	}
+
+	return domainCount, nil
+}
+
+// sortBySpread sorts the nodes by the spread constraint, the nodes in the domain having less volumes
+// of the group are preferred and the score order is kept among the same domain count
+func (c *SpreadConstraint) sortBySpread(domainCount map[string]int, nodes []*NodeView) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return domainCount[c.domain(nodes[i].NodeName)] < domainCount[c.domain(nodes[j].NodeName)]
+	})
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpreadConstraint_sortBySpread(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraint  *SpreadConstraint
+		domainCount map[string]int
+		want        []string
+	}{
+		{
+			name:        "no volume of the group",
+			constraint:  &SpreadConstraint{Group: "db"},
+			domainCount: map[string]int{},
+			want:        []string{"node1", "node2", "node3", "node4"},
+		},
+		{
+			name:        "node domain",
+			constraint:  &SpreadConstraint{Group: "db"},
+			domainCount: map[string]int{"node1": 2, "node3": 1},
+			want:        []string{"node2", "node4", "node3", "node1"},
+		},
+		{
+			name: "topology domain",
+			constraint: &SpreadConstraint{Group: "db", NodeDomains: map[string]string{
+				"node1": "rack1", "node2": "rack1", "node3": "rack2",
+			}},
+			domainCount: map[string]int{"rack1": 1, "node4": 1},
+			want:        []string{"node3", "node1", "node2", "node4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []*NodeView{{NodeName: "node1"}, {NodeName: "node2"}, {NodeName: "node3"}, {NodeName: "node4"}}
+			tt.constraint.sortBySpread(tt.domainCount, nodes)
+
+			got := make([]string, 0, len(nodes))
+			for _, node := range nodes {
+				got = append(got, node.NodeName)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortBySpread() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
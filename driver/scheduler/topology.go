@@ -2,8 +2,9 @@ package scheduler
 
 import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/logger"
 )
 
@@ -31,15 +32,20 @@ func filterTopologyRequirement(topologyReq *csi.TopologyRequirement) (map[string
 func filterTopology(topo []*csi.Topology) (map[string]bool, error) {
 	nodeMap := make(map[string]bool)
 
-	list, err := client.DefaultClient.ClientSet.CoreV1().Nodes().List(nil, metav1.ListOptions{})
+	nodes, err := client.NodeLister().List(labels.Everything())
 	if err != nil {
 		return nil, err
 	}
 
-	for _, node := range list.Items {
+	for _, node := range nodes {
 		for _, prf := range topo {
 			nodeFiltered := false
 			for key, value := range prf.Segments {
+				// the driver topology key is the node name itself
+				if key == crd.TopologyKey && node.Name == value {
+					continue
+				}
+
 				if node.Labels[key] != value {
 					nodeFiltered = true
 					break
@@ -54,3 +60,37 @@ func filterTopology(topo []*csi.Topology) (map[string]bool, error) {
 
 	return nodeMap, nil
 }
+
+// nodeTopologyDomains maps the nodes to the value of their topology label
+func nodeTopologyDomains(topologyKey string) (map[string]string, error) {
+	nodes, err := client.NodeLister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	nodeDomains := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		if domain, ok := node.Labels[topologyKey]; ok {
+			nodeDomains[node.Name] = domain
+		}
+	}
+
+	return nodeDomains, nil
+}
+
+// cordonedNodes returns the nodes marked unschedulable, no new volume is placed on them
+func cordonedNodes() (map[string]bool, error) {
+	nodes, err := client.NodeLister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	cordoned := make(map[string]bool)
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			cordoned[node.Name] = true
+		}
+	}
+
+	return cordoned, nil
+}
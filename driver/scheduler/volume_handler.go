@@ -1,13 +1,29 @@
 package scheduler
 
 import (
+	"k8s.io/client-go/tools/cache"
 	apis "qiniu.io/rio-csi/api/rio/v1"
 	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/logger"
 )
 
 func (s *VolumeScheduler) addVolume(obj interface{}) {
+	volume, ok := VolumeStructuredObject(obj)
+	if !ok {
+		return
+	}
 
+	if volume.Spec.VgPattern != s.VgPatternStr || volume.Status.State != crd.StatusPending {
+		return
+	}
+
+	// reserve the pending volume which isn't scheduled by this controller, eg. ephemeral volume
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if _, ok := s.CacheVolumeMap[volume.Name]; !ok {
+		s.CacheVolumeMap[volume.Name] = NewVolumeView(volume)
+		s.invalidateNodeScores(volume.Spec.OwnerNodeID)
+	}
 }
 
 func (s *VolumeScheduler) updateVolume(oldObj, newObj interface{}) {
@@ -18,20 +34,38 @@ func (s *VolumeScheduler) updateVolume(oldObj, newObj interface{}) {
 	}
 
 	switch newVolume.Status.State {
-	case crd.StatusReady, crd.StatusCreated, crd.StatusCloning:
+	case crd.StatusReady:
+		// the volume is provisioned, the node view counts its storage since then
+		s.UnscheduleVolume(newVolume.Name)
+	case crd.StatusCreated, crd.StatusCloning:
+		// the reservation is released when the volume is ready or the next node update counts the created volume
 		s.Lock.Lock()
 		defer s.Lock.Unlock()
 		if volumeView, ok := s.CacheVolumeMap[newVolume.Name]; ok {
 			volumeView.IsCreated = true
 		}
 	case crd.StatusFailed:
-		// TODO check error msg to decide whether space should be freed
+		if newVolume.Spec.VgPattern != s.VgPatternStr {
+			return
+		}
+
+		// the failed volume has reserved nothing, its partially created lv is removed by the owner node
+		s.RecordVolumeFailure(newVolume)
 	}
 
 }
 
 func (s *VolumeScheduler) deleteVolume(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	volume, ok := VolumeStructuredObject(obj)
+	if !ok {
+		return
+	}
 
+	s.UnscheduleVolume(volume.Name)
 }
 
 // VolumeStructuredObject get Obj from queue is not readily in lvmnode type. This function would convert obj into lvmnode type.
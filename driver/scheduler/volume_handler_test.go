@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/driver/dparams"
+	"testing"
+	"time"
+)
+
+func TestVolumeScheduler_updateVolume(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        string
+		wantReserved bool
+		wantCreated  bool
+		wantFailed   bool
+	}{
+		{
+			name:         "pending volume keeps the reservation",
+			state:        crd.StatusPending,
+			wantReserved: true,
+		},
+		{
+			name:         "created volume keeps the reservation until the node update",
+			state:        crd.StatusCreated,
+			wantReserved: true,
+			wantCreated:  true,
+		},
+		{
+			name:  "ready volume releases the reservation",
+			state: crd.StatusReady,
+		},
+		{
+			name:       "failed volume releases the reservation and records the node",
+			state:      crd.StatusFailed,
+			wantFailed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &VolumeScheduler{
+				VgPatternStr: "riovg.*",
+				NodeViewMap: map[string]*NodeView{
+					"node1": {NodeName: "node1", Scores: map[string]int64{dparams.VolumeWeighted: -1}},
+				},
+				CacheVolumeMap: map[string]*VolumeView{
+					"pvc-1": {Name: "pvc-1", NodeName: "node1", VgName: "riovg1", ReservedAt: time.Now()},
+				},
+				FailedNodeMap: map[string]map[string]time.Time{},
+			}
+
+			volume := &apis.Volume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+				Spec:       apis.VolumeSpec{VgPattern: "riovg.*", OwnerNodeID: "node1"},
+				Status:     apis.VolumeStatus{State: tt.state},
+			}
+			s.updateVolume(volume, volume)
+
+			view, reserved := s.CacheVolumeMap["pvc-1"]
+			if reserved != tt.wantReserved {
+				t.Errorf("updateVolume() reserved = %v, want %v", reserved, tt.wantReserved)
+			}
+			if reserved && view.IsCreated != tt.wantCreated {
+				t.Errorf("updateVolume() created = %v, want %v", view.IsCreated, tt.wantCreated)
+			}
+			if !reserved && s.NodeViewMap["node1"].Scores != nil {
+				t.Errorf("updateVolume() cached scores of node1 are not invalidated")
+			}
+			if got := s.isFailedNode("pvc-1", "node1"); got != tt.wantFailed {
+				t.Errorf("updateVolume() failed node = %v, want %v", got, tt.wantFailed)
+			}
+		})
+	}
+}
@@ -1,20 +1,53 @@
 package scheduler
 
 import (
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/client"
 	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/lib/lvm"
+	"qiniu.io/rio-csi/logger"
 	"strconv"
+	"time"
 )
 
+// failedNodeTTL is how long the node where a volume failed to provision is avoided
+// when the volume is rescheduled
+const failedNodeTTL = 30 * time.Minute
+
+// reservationTTL is how long the reservation of a volume is kept without checking its Volume CR,
+// it's longer than the rio node sync interval so that the created volume is counted in the node view
+const reservationTTL = 5 * time.Minute
+
 type VolumeView struct {
 	Name            string            `json:"name"`
 	NodeName        string            `json:"node_name"`
 	RequiredStorage resource.Quantity `json:"required_storage"`
 	VgName          string            `json:"vg_name"`
 	IsCreated       bool              `json:"is_created"`
+	SpreadGroup     string            `json:"spread_group"`
+	Thin            bool              `json:"thin"`
+	ReservedAt      time.Time         `json:"reserved_at"`
+}
+
+// NewVolumeView build the volume view of the pending volume CR
+func NewVolumeView(volume *apis.Volume) *VolumeView {
+	storageSize, _ := strconv.ParseInt(volume.Spec.Capacity, 10, 64)
+	storage := resource.NewQuantity(storageSize, resource.BinarySI)
+	return &VolumeView{
+		Name:            volume.Name,
+		NodeName:        volume.Spec.OwnerNodeID,
+		RequiredStorage: *storage,
+		VgName:          volume.Spec.VolGroup,
+		IsCreated:       false,
+		SpreadGroup:     volume.Labels[crd.SpreadGroupKey],
+		Thin:            volume.Spec.ThinProvision == lvm.YES,
+		ReservedAt:      time.Now(),
+	}
 }
 
+// SyncVolumeView rebuild the reservations of the pending volumes, eg. after the controller restarts
 func (s *VolumeScheduler) SyncVolumeView(volumes []*apis.Volume) {
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
@@ -25,16 +58,102 @@ func (s *VolumeScheduler) SyncVolumeView(volumes []*apis.Volume) {
 
 		switch volume.Status.State {
 		case crd.StatusPending:
-			storageSize, _ := strconv.ParseInt(volume.Spec.Capacity, 10, 64)
-			storage := resource.NewQuantity(storageSize, resource.BinarySI)
-			s.CacheVolumeMap[volume.Name] = &VolumeView{
-				Name:            volume.Name,
-				NodeName:        volume.Spec.OwnerNodeID,
-				RequiredStorage: *storage,
-				VgName:          volume.Spec.VolGroup,
-				IsCreated:       false,
-			}
+			s.CacheVolumeMap[volume.Name] = NewVolumeView(volume)
+			s.invalidateNodeScores(volume.Spec.OwnerNodeID)
+		}
+	}
+}
+
+// expireVolumeReservations checks the Volume CR of the reservations which outlive the ttl, the reservation
+// is released if the volume CR is not created, failed, deleted or has been created for a ttl,
+// the reservation of the pending volume is kept and checked again after another ttl
+func (s *VolumeScheduler) expireVolumeReservations() {
+	lister := client.DefaultInformer.Rio().V1().Volumes().Lister().Volumes(crd.RioNamespace)
+	for name, v := range s.CacheVolumeMap {
+		if time.Since(v.ReservedAt) < reservationTTL {
+			continue
+		}
+
+		volume, err := lister.Get(name)
+		if err != nil && !k8serror.IsNotFound(err) {
+			logger.StdLog.Errorf("get volume %s of reservation error %v", name, err)
+			continue
+		}
+
+		if err == nil && volume.GetDeletionTimestamp() == nil && volume.Status.State == crd.StatusPending {
+			v.ReservedAt = time.Now()
+			continue
+		}
+
+		logger.StdLog.Infof("release expired reservation of volume %s on node %s vg %s", name, v.NodeName, v.VgName)
+		delete(s.CacheVolumeMap, name)
+		s.invalidateNodeScores(v.NodeName)
+	}
+}
+
+// pendingVolumeSize returns the storage of the node vg reserved by the pending thick volumes
+func (s *VolumeScheduler) pendingVolumeSize(nodeName, vgName string) int64 {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.expireVolumeReservations()
+
+	var size int64
+	for _, v := range s.CacheVolumeMap {
+		// the thin volume is allocated from the thin pool instead of the vg free space
+		if v.NodeName == nodeName && v.VgName == vgName && !v.Thin {
+			size += v.RequiredStorage.Value()
+		}
+	}
+
+	return size
+}
+
+// UnscheduleVolume remove the volume from cache
+func (s *VolumeScheduler) UnscheduleVolume(name string) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if v, ok := s.CacheVolumeMap[name]; ok {
+		delete(s.CacheVolumeMap, name)
+		s.invalidateNodeScores(v.NodeName)
+	}
+}
 
+// RecordVolumeFailure release the storage reserved by the failed volume and remember its owner node,
+// so that the volume is rescheduled to another node
+func (s *VolumeScheduler) RecordVolumeFailure(volume *apis.Volume) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if v, ok := s.CacheVolumeMap[volume.Name]; ok {
+		delete(s.CacheVolumeMap, volume.Name)
+		s.invalidateNodeScores(v.NodeName)
+	}
+
+	failedNodes, ok := s.FailedNodeMap[volume.Name]
+	if !ok {
+		failedNodes = make(map[string]time.Time)
+		s.FailedNodeMap[volume.Name] = failedNodes
+	}
+	failedNodes[volume.Spec.OwnerNodeID] = time.Now()
+}
+
+// isFailedNode returns whether the volume has failed to provision on the node recently
+func (s *VolumeScheduler) isFailedNode(volumeName, nodeName string) bool {
+	failedNodes, ok := s.FailedNodeMap[volumeName]
+	if !ok {
+		return false
+	}
+
+	// forget the expired failure
+	for node, failedAt := range failedNodes {
+		if time.Since(failedAt) > failedNodeTTL {
+			delete(failedNodes, node)
 		}
 	}
+	if len(failedNodes) == 0 {
+		delete(s.FailedNodeMap, volumeName)
+		return false
+	}
+
+	_, ok = failedNodes[nodeName]
+	return ok
 }
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/generated/informer/externalversions"
+	"qiniu.io/rio-csi/generated/internalclientset/fake"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestVolumeScheduler_isFailedNode(t *testing.T) {
+	tests := []struct {
+		name        string
+		failedNodes map[string]map[string]time.Time
+		nodeName    string
+		want        bool
+	}{
+		{
+			name:        "no failure",
+			failedNodes: map[string]map[string]time.Time{},
+			nodeName:    "node1",
+			want:        false,
+		},
+		{
+			name:        "failed recently",
+			failedNodes: map[string]map[string]time.Time{"pvc-1": {"node1": time.Now()}},
+			nodeName:    "node1",
+			want:        true,
+		},
+		{
+			name:        "failed on other node",
+			failedNodes: map[string]map[string]time.Time{"pvc-1": {"node2": time.Now()}},
+			nodeName:    "node1",
+			want:        false,
+		},
+		{
+			name:        "failure expired",
+			failedNodes: map[string]map[string]time.Time{"pvc-1": {"node1": time.Now().Add(-failedNodeTTL - time.Minute)}},
+			nodeName:    "node1",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &VolumeScheduler{FailedNodeMap: tt.failedNodes}
+			if got := s.isFailedNode("pvc-1", tt.nodeName); got != tt.want {
+				t.Errorf("isFailedNode() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	s := &VolumeScheduler{FailedNodeMap: map[string]map[string]time.Time{
+		"pvc-1": {"node1": time.Now().Add(-failedNodeTTL - time.Minute)},
+	}}
+	s.isFailedNode("pvc-1", "node1")
+	if _, ok := s.FailedNodeMap["pvc-1"]; ok {
+		t.Errorf("isFailedNode() expired failures of pvc-1 are not forgotten")
+	}
+}
+
+func TestVolumeScheduler_expireVolumeReservations(t *testing.T) {
+	factory := externalversions.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	indexer := factory.Rio().V1().Volumes().Informer().GetIndexer()
+	now := metav1.Now()
+	volumes := []*apis.Volume{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-pending", Namespace: crd.RioNamespace},
+			Status:     apis.VolumeStatus{State: crd.StatusPending},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-ready", Namespace: crd.RioNamespace},
+			Status:     apis.VolumeStatus{State: crd.StatusReady},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-failed", Namespace: crd.RioNamespace},
+			Status:     apis.VolumeStatus{State: crd.StatusFailed},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-deleting", Namespace: crd.RioNamespace, DeletionTimestamp: &now},
+			Status:     apis.VolumeStatus{State: crd.StatusPending},
+		},
+	}
+	for _, volume := range volumes {
+		if err := indexer.Add(volume); err != nil {
+			t.Fatalf("add volume %s to indexer error %v", volume.Name, err)
+		}
+	}
+
+	defaultInformer := client.DefaultInformer
+	client.DefaultInformer = factory
+	defer func() { client.DefaultInformer = defaultInformer }()
+
+	expired := time.Now().Add(-reservationTTL - time.Minute)
+	s := &VolumeScheduler{CacheVolumeMap: map[string]*VolumeView{
+		"pvc-new":      {Name: "pvc-new", ReservedAt: time.Now()},
+		"pvc-pending":  {Name: "pvc-pending", ReservedAt: expired},
+		"pvc-ready":    {Name: "pvc-ready", ReservedAt: expired},
+		"pvc-failed":   {Name: "pvc-failed", ReservedAt: expired},
+		"pvc-deleting": {Name: "pvc-deleting", ReservedAt: expired},
+		"pvc-missing":  {Name: "pvc-missing", ReservedAt: expired},
+	}}
+	s.expireVolumeReservations()
+
+	got := make([]string, 0, len(s.CacheVolumeMap))
+	for name := range s.CacheVolumeMap {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if want := []string{"pvc-new", "pvc-pending"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expireVolumeReservations() got = %v, want %v", got, want)
+	}
+
+	if time.Since(s.CacheVolumeMap["pvc-pending"].ReservedAt) >= reservationTTL {
+		t.Errorf("expireVolumeReservations() reservation of the pending volume is not renewed")
+	}
+}
@@ -2,10 +2,16 @@ package driver
 
 import (
 	"fmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"k8s.io/utils/mount"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/crd"
 	"qiniu.io/rio-csi/driver/scheduler"
 	"qiniu.io/rio-csi/logger"
+	"qiniu.io/rio-csi/metrics"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
@@ -53,10 +59,108 @@ func ParseEndpoint(ep string) (string, string, error) {
 	return "", "", fmt.Errorf("invalid endpoint: %v", ep)
 }
 
+// isReadOnlyAccessMode returns whether the access mode only allows reading the volume
+func isReadOnlyAccessMode(mode csi.VolumeCapability_AccessMode_Mode) bool {
+	return mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY ||
+		mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+}
+
+// isReadOnlyVolume returns whether all the volume capabilities are read only,
+// such volume is write-protected in its iscsi target
+func isReadOnlyVolume(volCaps []*csi.VolumeCapability) bool {
+	if len(volCaps) == 0 {
+		return false
+	}
+
+	for _, volCap := range volCaps {
+		if !isReadOnlyAccessMode(volCap.GetAccessMode().GetMode()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getPublishedNodeIDs returns the distinct nodes the volume is mounted on
+func getPublishedNodeIDs(vol *apis.Volume) []string {
+	nodeIDs := make([]string, 0, len(vol.Spec.MountNodes))
+	exists := make(map[string]bool)
+	for _, info := range vol.Spec.MountNodes {
+		if info == nil || info.PodInfo == nil || info.PodInfo.NodeId == "" {
+			continue
+		}
+
+		if exists[info.PodInfo.NodeId] {
+			continue
+		}
+
+		exists[info.PodInfo.NodeId] = true
+		nodeIDs = append(nodeIDs, info.PodInfo.NodeId)
+	}
+
+	return nodeIDs
+}
+
+// getVolumeCondition returns the volume condition from the volume state, the error
+// of the last operation and the health checked by the owner node
+func getVolumeCondition(vol *apis.Volume) *csi.VolumeCondition {
+	if vol.Status.State == crd.StatusFailed {
+		msg := "volume provisioning failed"
+		if vol.Status.Error != nil {
+			msg = fmt.Sprintf("volume provisioning failed: %s", vol.Status.Error.Message)
+		}
+		return &csi.VolumeCondition{Abnormal: true, Message: msg}
+	}
+
+	if vol.Status.Error != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("volume error: %s", vol.Status.Error.Message),
+		}
+	}
+
+	if vol.Status.Condition != nil {
+		return &csi.VolumeCondition{
+			Abnormal: vol.Status.Condition.Abnormal,
+			Message:  vol.Status.Condition.Message,
+		}
+	}
+
+	if vol.Status.State != crd.StatusReady {
+		return &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  fmt.Sprintf("volume is %s", vol.Status.State),
+		}
+	}
+
+	return &csi.VolumeCondition{Abnormal: false, Message: "volume health is not checked yet"}
+}
+
+// buildCSISnapshot converts the Snapshot CR to csi snapshot with the size and creation time
+// recorded by the owner node
+func buildCSISnapshot(snap *apis.Snapshot) *csi.Snapshot {
+	volumeID := snap.Labels[crd.VolKey]
+	sizeBytes, _ := strconv.ParseInt(snap.Status.Size, 10, 64)
+	creationTime := snap.CreationTimestamp.Time
+	if snap.Status.CreationTime != nil {
+		creationTime = snap.Status.CreationTime.Time
+	}
+
+	return &csi.Snapshot{
+		SnapshotId:     snap.Name,
+		SourceVolumeId: volumeID,
+		SizeBytes:      sizeBytes,
+		CreationTime:   timestamppb.New(creationTime),
+		ReadyToUse:     snap.Status.State == crd.StatusReady,
+	}
+}
+
 func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	logger.StdLog.Infof("GRPC call: %s", info.FullMethod)
 	logger.StdLog.Infof("GRPC request: %s", protosanitizer.StripSecrets(req))
+	start := time.Now()
 	resp, err := handler(ctx, req)
+	metrics.ObserveGRPC(info.FullMethod, start, err)
 	if err != nil {
 		logger.StdLog.Errorf("GRPC error: %v", err)
 	} else {
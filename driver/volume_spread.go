@@ -0,0 +1,54 @@
+package driver
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"qiniu.io/rio-csi/client"
+	"qiniu.io/rio-csi/crd"
+	"qiniu.io/rio-csi/driver/dparams"
+)
+
+// applyPVCSpreadAnnotations overrides the spread params of the storage class by the pvc annotations,
+// so that the replicas of every workload can have their own spread group
+func applyPVCSpreadAnnotations(ctx context.Context, params *dparams.VolumeParams) error {
+	if params.PVCName == "" || params.PVCNamespace == "" {
+		return nil
+	}
+
+	pvc, err := client.DefaultClient.ClientSet.CoreV1().PersistentVolumeClaims(params.PVCNamespace).
+		Get(ctx, params.PVCName, metav1.GetOptions{})
+	if err != nil {
+		return status.Errorf(codes.Internal, "get pvc %s/%s error %v", params.PVCNamespace, params.PVCName, err)
+	}
+
+	annotationParams := map[string]*string{
+		crd.SpreadGroupKey:    &params.SpreadGroup,
+		crd.SpreadModeKey:     &params.SpreadMode,
+		crd.SpreadTopologyKey: &params.SpreadTopologyKey,
+	}
+	for key, param := range annotationParams {
+		value, ok := pvc.Annotations[key]
+		if !ok {
+			continue
+		}
+		*param = value
+	}
+
+	if err = params.ValidateSpread(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid spread annotations of pvc %s/%s: %v",
+			params.PVCNamespace, params.PVCName, err)
+	}
+
+	return nil
+}
+
+// spreadGroupLabels returns the label of the volume in the spread group
+func spreadGroupLabels(params *dparams.VolumeParams) map[string]string {
+	if params.SpreadGroup == "" {
+		return nil
+	}
+
+	return map[string]string{crd.SpreadGroupKey: params.SpreadGroup}
+}
@@ -480,6 +480,40 @@ func (c *Connector) DisconnectVolume(rawDevicePaths []string) error {
 	return nil
 }
 
+// ResizeVolume picks up the new size of a volume whose target lun has been grown.
+// It rescans every SCSI device of the volume and resizes the multipath map on top
+// of them if multipath is enabled.
+func (c *Connector) ResizeVolume(rawDevicePaths []string) error {
+	if len(rawDevicePaths) == 0 {
+		return fmt.Errorf("unable to resize volume %s: no device path given", c.VolumeName)
+	}
+
+	var err error
+	if c.Devices, err = GetISCSIDevices(rawDevicePaths, true); err != nil {
+		return err
+	}
+
+	for _, device := range c.Devices {
+		debug.Printf("Rescan SCSI device %s.\n", device.Name)
+		if err := device.Rescan(); err != nil {
+			return err
+		}
+	}
+
+	mountTargetDevice, err := c.getMountTargetDevice()
+	if err != nil {
+		return err
+	}
+	c.MountTargetDevice = mountTargetDevice
+
+	if c.IsMultipathEnabled() {
+		return ResizeMultipathDevice(c.MountTargetDevice)
+	}
+
+	debug.Printf("Finished resizing volume %s.\n", c.VolumeName)
+	return nil
+}
+
 // getMountTargetDevice returns the device to be mounted among the configured devices
 func (c *Connector) getMountTargetDevice() (*Device, error) {
 	if len(c.Devices) > 1 {
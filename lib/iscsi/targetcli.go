@@ -15,9 +15,11 @@ var (
 	createCmd      = "create %s"
 	deleteCmd      = "delete %s"
 	createBlockCmd = "create %s %s"
-	cdCmd          = "cd %s"
-	setUserIDCmd   = "set auth userid=%s"
-	setPasswordCmd = "set auth password=%s"
+	// readonly block backstore makes the lun write-protected for all initiators
+	createReadOnlyBlockCmd = "create %s %s readonly=true"
+	cdCmd                  = "cd %s"
+	setUserIDCmd           = "set auth userid=%s"
+	setPasswordCmd         = "set auth password=%s"
 
 	setDiscoveryAuth = "set discovery_auth enable=1 userid=%s password=%s"
 
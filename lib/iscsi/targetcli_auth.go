@@ -75,3 +75,26 @@ func ListTargetAcl(target string) (aclInitiator []string, err error) {
 
 	return
 }
+
+// DeleteTargetAcl remove target acl rules of the initiator
+func DeleteTargetAcl(target, initiator string) (string, error) {
+	cmd := NewExecCmd()
+	cmd.Add(openIscsiDir)
+	cmd.AddFormat(cdCmd, target)
+	cmd.Add(openAclsDir)
+	// delete acls
+	cmd.AddFormat(deleteCmd, initiator)
+
+	Lock.Lock()
+	defer Lock.Unlock()
+
+	res, err := cmd.Exec()
+	if err != nil {
+		// repeat delete
+		if strings.Contains(err.Error(), "No such NodeACL") || strings.Contains(err.Error(), "No such path") {
+			return res, nil
+		}
+	}
+
+	return res, err
+}
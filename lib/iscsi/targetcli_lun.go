@@ -2,6 +2,8 @@ package iscsi
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -103,3 +105,71 @@ func LunList(target string) ([]*LunDevice, error) {
 	return res, nil
 
 }
+
+// lioConfigfsDir is the configfs directory of the LIO iscsi fabric
+const lioConfigfsDir = "/sys/kernel/config/target/iscsi"
+
+// TargetLunCount returns the lun count of every LIO iscsi target on this node,
+// it reads configfs directly so it doesn't need targetcli and the global lock
+func TargetLunCount() (map[string]int, error) {
+	tpgts, err := filepath.Glob(filepath.Join(lioConfigfsDir, "iqn.*", "tpgt_*"))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]int, len(tpgts))
+	for _, tpgt := range tpgts {
+		target := filepath.Base(filepath.Dir(tpgt))
+		luns, err := filepath.Glob(filepath.Join(tpgt, "lun", "lun_*"))
+		if err != nil {
+			return nil, err
+		}
+
+		res[target] += len(luns)
+	}
+
+	return res, nil
+}
+
+// TargetLunDisks returns the block backstores exported as luns by every LIO iscsi target on this node,
+// it reads configfs directly so it doesn't need targetcli and the global lock
+func TargetLunDisks() (map[string]map[string]bool, error) {
+	targets, err := filepath.Glob(filepath.Join(lioConfigfsDir, "iqn.*"))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]map[string]bool, len(targets))
+	for _, target := range targets {
+		disks := make(map[string]bool)
+		res[filepath.Base(target)] = disks
+
+		luns, err := filepath.Glob(filepath.Join(target, "tpgt_*", "lun", "lun_*"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lun := range luns {
+			entries, err := os.ReadDir(lun)
+			if err != nil {
+				return nil, err
+			}
+
+			// the lun links to its backstore in target/core/<hba>/<backstore>
+			for _, entry := range entries {
+				if entry.Type()&os.ModeSymlink == 0 {
+					continue
+				}
+
+				dest, err := os.Readlink(filepath.Join(lun, entry.Name()))
+				if err != nil {
+					return nil, err
+				}
+
+				disks[filepath.Base(dest)] = true
+			}
+		}
+	}
+
+	return res, nil
+}
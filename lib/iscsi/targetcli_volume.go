@@ -5,11 +5,16 @@ import (
 	"strings"
 )
 
-// PublicBlockDevice publish device as block device
-func PublicBlockDevice(disk, device string) (string, error) {
+// PublicBlockDevice publish device as block device, the lun of
+// readOnly block device is write-protected
+func PublicBlockDevice(disk, device string, readOnly bool) (string, error) {
 	cmd := NewExecCmd()
 	cmd.Add(openBlockDir)
-	cmd.AddFormat(createBlockCmd, disk, device)
+	if readOnly {
+		cmd.AddFormat(createReadOnlyBlockCmd, disk, device)
+	} else {
+		cmd.AddFormat(createBlockCmd, disk, device)
+	}
 
 	Lock.Lock()
 	defer Lock.Unlock()
@@ -133,6 +133,12 @@ func (b *Builder) WithShared(shared string) *Builder {
 	return b
 }
 
+// WithReadOnly sets whether the volume can only be used read only
+func (b *Builder) WithReadOnly(readOnly string) *Builder {
+	b.volume.Object.Spec.ReadOnly = readOnly
+	return b
+}
+
 // WithThinProvision sets where thinProvision is enable or not
 func (b *Builder) WithThinProvision(thinProvision string) *Builder {
 	b.volume.Object.Spec.ThinProvision = thinProvision
@@ -201,6 +207,23 @@ func (b *Builder) WithLabels(labels map[string]string) *Builder {
 	return b
 }
 
+// WithAnnotations merges existing annotations if any
+// with the ones that are provided here
+func (b *Builder) WithAnnotations(annotations map[string]string) *Builder {
+	if len(annotations) == 0 {
+		return b
+	}
+
+	if b.volume.Object.Annotations == nil {
+		b.volume.Object.Annotations = map[string]string{}
+	}
+
+	for key, value := range annotations {
+		b.volume.Object.Annotations[key] = value
+	}
+	return b
+}
+
 // WithFinalizer sets Finalizer name creating the volume
 func (b *Builder) WithFinalizer(finalizer []string) *Builder {
 	b.volume.Object.Finalizers = append(b.volume.Object.Finalizers, finalizer...)
@@ -398,7 +398,18 @@ func ListVolumeGroup(reloadCache bool) ([]apis.VolumeGroup, error) {
 		klog.Errorf("lvm: list volume group cmd %v: %v", args, err)
 		return nil, err
 	}
-	return decodeVgsJSON(b.Bytes())
+
+	vgs, err := decodeVgsJSON(b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// report the thin pools managed by the driver
+	if err = setThinPools(vgs); err != nil {
+		return nil, err
+	}
+
+	return vgs, nil
 }
 
 // Function to get LVM Logical volume device
@@ -756,39 +767,40 @@ func isSnapshotExists(vg, snapVolumeName string) (bool, error) {
 	return snapVolumeName == strings.TrimSpace(string(out)), nil
 }
 
-// getVGSize get the size in bytes for given volumegroup name
-func getVGSize(vgname string) string {
-	cmd := exec.Command("vgs", vgname, "--noheadings", "-o", "vg_free", "--units", "b", "--nosuffix")
+// getVGSize get the size and free size in bytes for given volumegroup name
+func getVGSize(vgname string) (size, free int64, err error) {
+	cmd := exec.Command(VGList, vgname, "--noheadings", "-o", "vg_size,vg_free", "--units", "b", "--nosuffix")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		klog.Errorf("failed to list existing volumegroup:%v , %v", vgname, err)
-		return ""
+		return 0, 0, newExecError(out, err)
 	}
-	return strings.TrimSpace(string(out))
-}
 
-// getThinPoolSize gets size for a given volumegroup, compares it with
-// the requested volume size and returns the minimum size as a thin pool size
-func getThinPoolSize(vgname, volsize string) string {
-	outStr := getVGSize(vgname)
-	vgFreeSize, err := strconv.ParseInt(strings.TrimSpace(string(outStr)), 10, 64)
-	if err != nil {
-		klog.Errorf("failed to convert vg_size to int, got size,:%v , %v", outStr, err)
-		return ""
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("invalid size output %q of volumegroup %v", string(out), vgname)
 	}
 
-	volSize, err := strconv.ParseInt(strings.TrimSpace(string(volsize)), 10, 64)
-	if err != nil {
-		klog.Errorf("failed to convert volsize to int, got size,:%v , %v", volSize, err)
-		return ""
+	if size, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("failed to convert vg_size %v to int: %v", fields[0], err)
 	}
 
-	if vgFreeSize < volSize {
-		// reducing 268435456 bytes (256Mi) from the total byte size to round off
-		// blocks extent
-		return fmt.Sprint(vgFreeSize-MinExtentRoundOffSize) + "b"
+	if free, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("failed to convert vg_free %v to int: %v", fields[1], err)
 	}
-	return volsize + "b"
+
+	return size, free, nil
+}
+
+// getThinPoolSize gets the thin pool size of a given volumegroup by the thin pool policy,
+// it's bounded by the volumegroup free size
+func getThinPoolSize(vgname string, policy ThinPoolPolicy) (int64, error) {
+	vgSize, vgFree, err := getVGSize(vgname)
+	if err != nil {
+		return 0, err
+	}
+
+	return policy.PoolSize(vgSize, vgFree), nil
 }
 
 // removeVolumeFilesystem will erases the filesystem signature from lvm volume
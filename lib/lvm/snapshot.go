@@ -32,6 +32,10 @@ func buildLVMSnapCreateArgs(snap *apis.Snapshot) []string {
 	if len(snap.Spec.SnapSize) != 0 {
 		// size of the snapshot, will be same or less than source volume
 		LVMSnapArg = append(LVMSnapArg, "--size", size)
+	} else {
+		// thin snapshot is skipped on activation by default, activate it
+		// so that it can be read when restoring or cloning
+		LVMSnapArg = append(LVMSnapArg, "--setactivationskip", "n")
 	}
 	return LVMSnapArg
 }
@@ -59,7 +63,7 @@ func CreateSnapshot(snap *apis.Snapshot) error {
 
 	if err != nil {
 		logger.StdLog.Errorf("lvm: could not create snapshot %s cmd %v error: %s", snapVolume, args, string(out))
-		return err
+		return newExecError(out, err)
 	}
 
 	logger.StdLog.Infof("created snapshot %s from %s", snapVolume, volume)
@@ -0,0 +1,369 @@
+package lvm
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	"os/exec"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/conf"
+	"qiniu.io/rio-csi/logger"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ThinPoolSuffix is the suffix of the thin pool name, the thin pool of vg riovg is riovg_thinpool
+	ThinPoolSuffix = "_thinpool"
+
+	defaultThinPoolSizePercent       = 90
+	defaultThinPoolAutoextendPercent = 20
+)
+
+// ThinPoolPolicy is how the thin pool of every volume group is created, extended and overcommitted
+type ThinPoolPolicy struct {
+	// SizePercent is the pool size in percentage of the vg size, it's used if SizeBytes is 0
+	SizePercent float64
+	SizeBytes   int64
+	// MetadataSizeBytes is the metadata size of the pool, lvm picks it if it's 0
+	MetadataSizeBytes int64
+	// OvercommitRatio bounds the total size of the thin volumes to the ratio of the pool size, 0 means unbounded
+	OvercommitRatio float64
+	// AutoextendThreshold is the data or metadata usage percentage to extend the pool at, 0 disables autoextend
+	AutoextendThreshold int
+	AutoextendPercent   int
+}
+
+var (
+	thinPoolPolicy = ThinPoolPolicy{
+		SizePercent:       defaultThinPoolSizePercent,
+		AutoextendPercent: defaultThinPoolAutoextendPercent,
+	}
+	// blockedThinPools are the vgs whose thin pool reaches the autoextend threshold but cant be extended
+	blockedThinPools = make(map[string]bool)
+	thinPoolLock     sync.RWMutex
+)
+
+// SetThinPoolPolicy sets the thin pool policy by the driver config, the invalid values are ignored
+func SetThinPoolPolicy(config *conf.Config) {
+	policy := ThinPoolPolicy{
+		SizePercent:         defaultThinPoolSizePercent,
+		OvercommitRatio:     config.ThinOvercommitRatio,
+		AutoextendThreshold: config.ThinPoolAutoextendThreshold,
+		AutoextendPercent:   config.ThinPoolAutoextendPercent,
+	}
+
+	if size := strings.TrimSpace(config.ThinPoolSize); size != "" {
+		if strings.HasSuffix(size, "%") {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(size, "%"), 64)
+			if err != nil || percent <= 0 || percent > 100 {
+				logger.StdLog.Warnf("invalid thin_pool_size %s, use default %d%%", size, defaultThinPoolSizePercent)
+			} else {
+				policy.SizePercent = percent
+			}
+		} else {
+			quantity, err := resource.ParseQuantity(size)
+			if err != nil || quantity.Value() <= 0 {
+				logger.StdLog.Warnf("invalid thin_pool_size %s, use default %d%%", size, defaultThinPoolSizePercent)
+			} else {
+				policy.SizeBytes = quantity.Value()
+			}
+		}
+	}
+
+	if size := strings.TrimSpace(config.ThinPoolMetadataSize); size != "" {
+		quantity, err := resource.ParseQuantity(size)
+		if err != nil || quantity.Value() < 0 {
+			logger.StdLog.Warnf("invalid thin_pool_metadata_size %s, let lvm pick it", size)
+		} else {
+			policy.MetadataSizeBytes = quantity.Value()
+		}
+	}
+
+	if policy.OvercommitRatio < 0 {
+		logger.StdLog.Warnf("invalid thin_overcommit_ratio %v, overcommit is unbounded", policy.OvercommitRatio)
+		policy.OvercommitRatio = 0
+	}
+
+	if policy.AutoextendThreshold < 0 || policy.AutoextendThreshold > 100 {
+		logger.StdLog.Warnf("invalid thin_pool_autoextend_threshold %d, autoextend is disabled", policy.AutoextendThreshold)
+		policy.AutoextendThreshold = 0
+	}
+
+	if policy.AutoextendPercent <= 0 {
+		policy.AutoextendPercent = defaultThinPoolAutoextendPercent
+	}
+
+	thinPoolLock.Lock()
+	defer thinPoolLock.Unlock()
+	thinPoolPolicy = policy
+}
+
+// GetThinPoolPolicy returns the thin pool policy
+func GetThinPoolPolicy() ThinPoolPolicy {
+	thinPoolLock.RLock()
+	defer thinPoolLock.RUnlock()
+	return thinPoolPolicy
+}
+
+// ThinPoolName returns the name of the thin pool managed by the driver in the vg
+func ThinPoolName(vgName string) string {
+	return vgName + ThinPoolSuffix
+}
+
+// PoolSize returns the size of the thin pool to create in the vg, it's bounded by the vg free space
+// leaving room for the pool metadata and its spare and rounding off the extents
+func (p ThinPoolPolicy) PoolSize(vgSize, vgFree int64) int64 {
+	size := p.SizeBytes
+	if size == 0 {
+		size = int64(float64(vgSize) * p.SizePercent / 100)
+	}
+
+	if limit := vgFree - 2*p.MetadataSizeBytes - MinExtentRoundOffSize; size > limit {
+		size = limit
+	}
+
+	if size < 0 {
+		return 0
+	}
+
+	return size
+}
+
+// ThinAvailable returns the total size of the thin volumes can still be created in the thin pool of the vg
+// by the overcommit ratio, the pool size is planned by the policy if the pool is not created yet.
+// math.MaxInt64 means unbounded
+func ThinAvailable(vg apis.VolumeGroup) int64 {
+	policy := GetThinPoolPolicy()
+
+	var poolSize, virtualSize int64
+	if vg.ThinPool != nil {
+		poolSize = vg.ThinPool.Size.Value()
+		virtualSize = vg.ThinPool.VirtualSize.Value()
+	} else {
+		poolSize = policy.PoolSize(vg.Size.Value(), vg.Free.Value())
+	}
+
+	if poolSize <= 0 {
+		return 0
+	}
+
+	if policy.OvercommitRatio == 0 {
+		return math.MaxInt64
+	}
+
+	return int64(policy.OvercommitRatio*float64(poolSize)) - virtualSize
+}
+
+// CreateThinPool creates the thin pool of the vg by the policy, it's called at the first thin volume
+// of the vg and does nothing if the pool exists
+func CreateThinPool(vgName string) error {
+	pool := ThinPoolName(vgName)
+	if lvThinExists(vgName, pool) {
+		return nil
+	}
+
+	policy := GetThinPoolPolicy()
+	size, err := getThinPoolSize(vgName, policy)
+	if err != nil {
+		return err
+	}
+
+	if size <= 0 {
+		return fmt.Errorf("insufficient free space in vg %s to create thin pool %s", vgName, pool)
+	}
+
+	args := []string{"--type", LVThinPool, "-L", fmt.Sprintf("%db", size), "-n", pool}
+	if policy.MetadataSizeBytes > 0 {
+		args = append(args, "--poolmetadatasize", fmt.Sprintf("%db", policy.MetadataSizeBytes))
+	}
+	args = append(args, "-y", vgName)
+
+	output, err := exec.Command(LVCreate, args...).CombinedOutput()
+	if err != nil {
+		logger.StdLog.Errorf("lvm: create thin pool %s/%s cmd %v error: %s", vgName, pool, args, string(output))
+		return newExecError(output, err)
+	}
+
+	logger.StdLog.Infof("lvm: created thin pool %s/%s size %d", vgName, pool, size)
+	return nil
+}
+
+// ExtendThinPools extends the data or metadata of the thin pools managed by the driver
+// whose usage reaches the autoextend threshold of the policy. The pools are not extended
+// into the vg space of the pending thick volumes whose lv is not created yet
+func ExtendThinPools(pending []*apis.Volume) error {
+	policy := GetThinPoolPolicy()
+	blocked := make(map[string]bool)
+	defer setBlockedThinPools(blocked)
+
+	if policy.AutoextendThreshold == 0 {
+		return nil
+	}
+
+	lvs, err := ListLVMLogicalVolume()
+	if err != nil {
+		return err
+	}
+
+	threshold := float64(policy.AutoextendThreshold)
+	var vgFree map[string]int64
+	for _, lv := range lvs {
+		if lv.SegType != LVThinPool || lv.Name != ThinPoolName(lv.VGName) {
+			continue
+		}
+
+		if lv.UsedSizePercent < threshold && lv.MetadataUsedPercent < threshold {
+			continue
+		}
+
+		if vgFree == nil {
+			if vgFree, err = listVgFree(); err != nil {
+				return err
+			}
+		}
+
+		available := vgFree[lv.VGName] - pendingThickSize(lvs, pending, lv.VGName)
+		if lv.UsedSizePercent >= threshold {
+			extend := lv.Size * int64(policy.AutoextendPercent) / 100
+			if available < extend {
+				logger.StdLog.Warnf("lvm: thin pool %s/%s data %.2f%% cant be extended by %d, vg available %d",
+					lv.VGName, lv.Name, lv.UsedSizePercent, extend, available)
+				blocked[lv.VGName] = true
+			} else if extendErr := extendThinPool(lv, "-L", fmt.Sprintf("+%db", extend)); extendErr != nil {
+				err = extendErr
+			} else {
+				available -= extend
+			}
+		}
+
+		if lv.MetadataUsedPercent >= threshold {
+			extend := lv.MetadataSize * int64(policy.AutoextendPercent) / 100
+			// the spare metadata lv grows with the pool metadata
+			if available < 2*extend {
+				logger.StdLog.Warnf("lvm: thin pool %s/%s metadata %.2f%% cant be extended by %d, vg available %d",
+					lv.VGName, lv.Name, lv.MetadataUsedPercent, extend, available)
+				blocked[lv.VGName] = true
+			} else if extendErr := extendThinPool(lv, "--poolmetadatasize", fmt.Sprintf("+%db", extend)); extendErr != nil {
+				err = extendErr
+			}
+		}
+	}
+
+	return err
+}
+
+// pendingThickSize returns the vg space reserved by the pending thick volumes whose lv is not created yet
+func pendingThickSize(lvs []LogicalVolume, pending []*apis.Volume, vgName string) int64 {
+	var size int64
+	for _, vol := range pending {
+		if vol.Spec.VolGroup != vgName || vol.Spec.ThinProvision == YES {
+			continue
+		}
+
+		created := false
+		for _, lv := range lvs {
+			if lv.VGName == vgName && lv.Name == vol.Name {
+				created = true
+				break
+			}
+		}
+
+		if !created {
+			capacity, _ := strconv.ParseInt(vol.Spec.Capacity, 10, 64)
+			size += capacity
+		}
+	}
+
+	return size
+}
+
+// listVgFree returns the free space of every vg
+func listVgFree() (map[string]int64, error) {
+	vgs, err := ListVolumeGroup(false)
+	if err != nil {
+		return nil, err
+	}
+
+	vgFree := make(map[string]int64, len(vgs))
+	for _, vg := range vgs {
+		vgFree[vg.Name] = vg.Free.Value()
+	}
+
+	return vgFree, nil
+}
+
+// setBlockedThinPools records the vgs whose thin pool cant be extended for lack of free space
+func setBlockedThinPools(blocked map[string]bool) {
+	thinPoolLock.Lock()
+	defer thinPoolLock.Unlock()
+	blockedThinPools = blocked
+}
+
+// isThinPoolBlocked returns whether the autoextend of the thin pool of the vg is blocked
+func isThinPoolBlocked(vgName string) bool {
+	thinPoolLock.RLock()
+	defer thinPoolLock.RUnlock()
+	return blockedThinPools[vgName]
+}
+
+func extendThinPool(lv LogicalVolume, option, extend string) error {
+	pool := lv.VGName + "/" + lv.Name
+	args := []string{option, extend, pool}
+	output, err := exec.Command(LVExtend, args...).CombinedOutput()
+	if err != nil {
+		logger.StdLog.Errorf("lvm: extend thin pool %s data %.2f%% metadata %.2f%% cmd %v error: %s",
+			pool, lv.UsedSizePercent, lv.MetadataUsedPercent, args, string(output))
+		return newExecError(output, err)
+	}
+
+	logger.StdLog.Infof("lvm: extended thin pool %s data %.2f%% metadata %.2f%% by %s %s",
+		pool, lv.UsedSizePercent, lv.MetadataUsedPercent, option, extend)
+	return nil
+}
+
+// setThinPools sets the thin pools managed by the driver and their usage to the vgs
+func setThinPools(vgs []apis.VolumeGroup) error {
+	lvs, err := ListLVMLogicalVolume()
+	if err != nil {
+		return err
+	}
+
+	for i := range vgs {
+		vg := &vgs[i]
+		pool := ThinPoolName(vg.Name)
+		var thinPool *apis.ThinPool
+		var virtualSize int64
+		var thinCount int32
+		for _, lv := range lvs {
+			if lv.VGName != vg.Name {
+				continue
+			}
+
+			if lv.Name == pool && lv.SegType == LVThinPool {
+				thinPool = &apis.ThinPool{
+					Name:         pool,
+					Size:         *resource.NewQuantity(lv.Size, resource.BinarySI),
+					DataUsed:     *resource.NewQuantity(int64(float64(lv.Size)*lv.UsedSizePercent/100), resource.BinarySI),
+					MetadataSize: *resource.NewQuantity(lv.MetadataSize, resource.BinarySI),
+					MetadataUsed: *resource.NewQuantity(int64(float64(lv.MetadataSize)*lv.MetadataUsedPercent/100), resource.BinarySI),
+				}
+			}
+
+			if lv.PoolName == pool {
+				virtualSize += lv.Size
+				thinCount++
+			}
+		}
+
+		if thinPool != nil {
+			thinPool.VirtualSize = *resource.NewQuantity(virtualSize, resource.BinarySI)
+			thinPool.ThinCount = thinCount
+			thinPool.AutoextendBlocked = isThinPoolBlocked(vg.Name)
+		}
+		vg.ThinPool = thinPool
+	}
+
+	return nil
+}
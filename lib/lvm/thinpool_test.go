@@ -0,0 +1,110 @@
+package lvm
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/conf"
+	"testing"
+)
+
+const gi = int64(1 << 30)
+
+func TestSetThinPoolPolicy(t *testing.T) {
+	defer SetThinPoolPolicy(&conf.Config{})
+
+	tests := []struct {
+		name   string
+		config *conf.Config
+		want   ThinPoolPolicy
+	}{
+		{
+			name:   "default policy",
+			config: &conf.Config{},
+			want:   ThinPoolPolicy{SizePercent: 90, AutoextendPercent: 20},
+		},
+		{
+			name: "percent size and overcommit",
+			config: &conf.Config{ThinPoolSize: "50%", ThinPoolMetadataSize: "1Gi", ThinOvercommitRatio: 2,
+				ThinPoolAutoextendThreshold: 80, ThinPoolAutoextendPercent: 10},
+			want: ThinPoolPolicy{SizePercent: 50, MetadataSizeBytes: gi, OvercommitRatio: 2,
+				AutoextendThreshold: 80, AutoextendPercent: 10},
+		},
+		{
+			name:   "quantity size",
+			config: &conf.Config{ThinPoolSize: "100Gi"},
+			want:   ThinPoolPolicy{SizePercent: 90, SizeBytes: 100 * gi, AutoextendPercent: 20},
+		},
+		{
+			name: "invalid values are ignored",
+			config: &conf.Config{ThinPoolSize: "150%", ThinPoolMetadataSize: "x", ThinOvercommitRatio: -1,
+				ThinPoolAutoextendThreshold: 120},
+			want: ThinPoolPolicy{SizePercent: 90, AutoextendPercent: 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetThinPoolPolicy(tt.config)
+			if got := GetThinPoolPolicy(); got != tt.want {
+				t.Errorf("SetThinPoolPolicy() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThinAvailable(t *testing.T) {
+	defer SetThinPoolPolicy(&conf.Config{})
+
+	tests := []struct {
+		name   string
+		config *conf.Config
+		vg     apis.VolumeGroup
+		want   int64
+	}{
+		{
+			name:   "unbounded overcommit",
+			config: &conf.Config{},
+			vg:     apis.VolumeGroup{Size: *resource.NewQuantity(100*gi, resource.BinarySI), Free: *resource.NewQuantity(100*gi, resource.BinarySI)},
+			want:   math.MaxInt64,
+		},
+		{
+			name:   "pool planned by the policy",
+			config: &conf.Config{ThinPoolSize: "50%", ThinOvercommitRatio: 2},
+			vg:     apis.VolumeGroup{Size: *resource.NewQuantity(100*gi, resource.BinarySI), Free: *resource.NewQuantity(100*gi, resource.BinarySI)},
+			want:   100 * gi,
+		},
+		{
+			name:   "planned pool bounded by the vg free space",
+			config: &conf.Config{ThinPoolSize: "50%", ThinOvercommitRatio: 2},
+			vg:     apis.VolumeGroup{Size: *resource.NewQuantity(100*gi, resource.BinarySI), Free: *resource.NewQuantity(10*gi, resource.BinarySI)},
+			want:   2 * (10*gi - MinExtentRoundOffSize),
+		},
+		{
+			name:   "no space for the pool",
+			config: &conf.Config{},
+			vg:     apis.VolumeGroup{Size: *resource.NewQuantity(100*gi, resource.BinarySI), Free: *resource.NewQuantity(0, resource.BinarySI)},
+			want:   0,
+		},
+		{
+			name:   "existing pool",
+			config: &conf.Config{ThinOvercommitRatio: 1.5},
+			vg: apis.VolumeGroup{
+				Size: *resource.NewQuantity(100*gi, resource.BinarySI),
+				Free: *resource.NewQuantity(0, resource.BinarySI),
+				ThinPool: &apis.ThinPool{
+					Size:        *resource.NewQuantity(80*gi, resource.BinarySI),
+					VirtualSize: *resource.NewQuantity(100*gi, resource.BinarySI),
+				},
+			},
+			want: 20 * gi,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetThinPoolPolicy(tt.config)
+			if got := ThinAvailable(tt.vg); got != tt.want {
+				t.Errorf("ThinAvailable() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
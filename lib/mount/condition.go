@@ -0,0 +1,83 @@
+package mount
+
+import (
+	"fmt"
+	"io"
+	"k8s.io/utils/mount"
+	"os"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/lib/iscsi"
+	"qiniu.io/rio-csi/lib/mount/mtypes"
+)
+
+// GetBlockDeviceSize returns the size in bytes of the block device at path,
+// path can be the device node or the file it's bind mounted to
+func GetBlockDeviceSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// seek to the end of the block device returns its size
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("get size of block device %s error %v", path, err)
+	}
+
+	return size, nil
+}
+
+// CheckVolumeCondition checks the volume published at path on this node, the volume is abnormal
+// if its device is missing, the iscsi session is logged out or the filesystem has been remounted
+// read only by the kernel after io errors
+func CheckVolumeCondition(vol *apis.Volume, info *mtypes.Info, path string) (abnormal bool, message string) {
+	if info == nil || info.VolumeInfo == nil {
+		return true, fmt.Sprintf("volume %s mount info of path %s not found", vol.Name, path)
+	}
+
+	devicePath := info.VolumeInfo.DevicePath
+	if _, err := os.Stat(devicePath); err != nil {
+		return true, fmt.Sprintf("volume %s device %s is missing: %v", vol.Name, devicePath, err)
+	}
+
+	if !info.VolumeInfo.Local {
+		sessions, err := iscsi.GetCurrentSessions()
+		if err != nil {
+			return true, fmt.Sprintf("list iscsi sessions error %v", err)
+		}
+
+		hasSession := false
+		for _, session := range sessions {
+			if session.IQN == vol.Spec.IscsiTarget {
+				hasSession = true
+				break
+			}
+		}
+
+		if !hasSession {
+			return true, fmt.Sprintf("iscsi session of target %s is missing", vol.Spec.IscsiTarget)
+		}
+	}
+
+	if info.MountType == mtypes.TypeFileSystem && !IsReadOnly(info.VolumeInfo) {
+		mountPoints, err := mount.New("").List()
+		if err != nil {
+			return true, fmt.Sprintf("list mount points error %v", err)
+		}
+
+		for _, mp := range mountPoints {
+			if mp.Path != path {
+				continue
+			}
+
+			for _, opt := range mp.Opts {
+				if opt == "ro" {
+					return true, fmt.Sprintf("volume %s is remounted read only at %s, the device may have io errors", vol.Name, path)
+				}
+			}
+		}
+	}
+
+	return false, "volume is healthy"
+}
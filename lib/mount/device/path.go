@@ -0,0 +1,27 @@
+package device
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// CanonicalPath resolves the symlinks of the device path, eg. /dev/<vg>/<lv> and /dev/mapper/<vg>-<lv>
+// are both resolved to /dev/dm-N, the path is returned as is if it's not a device file or can't be resolved
+func CanonicalPath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return path
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+
+	return resolved
+}
+
+// IsSameDevice reports whether the device paths refer to the same device,
+// mount(8) records the path it's given while the volume device can be linked by several paths
+func IsSameDevice(a, b string) bool {
+	return a == b || CanonicalPath(a) == CanonicalPath(b)
+}
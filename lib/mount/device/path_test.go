@@ -0,0 +1,51 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsSameDevice(t *testing.T) {
+	dir := t.TempDir()
+	dm := filepath.Join(dir, "dm-0")
+	other := filepath.Join(dir, "dm-1")
+	vgPath := filepath.Join(dir, "riovg", "pvc-1")
+	mapperPath := filepath.Join(dir, "mapper", "riovg-pvc--1")
+
+	for _, path := range []string{dm, other} {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, link := range []string{vgPath, mapperPath} {
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join("..", "dm-0"), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want bool
+	}{
+		{name: "same path", a: vgPath, b: vgPath, want: true},
+		{name: "vg path and mapper path", a: vgPath, b: mapperPath, want: true},
+		{name: "link and device", a: mapperPath, b: dm, want: true},
+		{name: "different devices", a: vgPath, b: other, want: false},
+		{name: "missing device", a: filepath.Join(dir, "missing"), b: dm, want: false},
+		{name: "not a device path", a: "tmpfs", b: dm, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSameDevice(tt.a, tt.b); got != tt.want {
+				t.Errorf("IsSameDevice(%s, %s) got = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
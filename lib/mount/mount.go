@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/equality"
 	utilexec "k8s.io/utils/exec"
 	"k8s.io/utils/mount"
 	"os"
@@ -33,17 +34,138 @@ var (
 	Lock sync.Mutex
 )
 
-func MountVolume(vol *apis.Volume, info *mtypes.Info, iscsiUsername, iscsiPassword string) error {
-	// TODO vol and pod on the same node to local mount
-	connector, err := NewIscsiConnector(vol, iscsiUsername, iscsiPassword)
+// StageVolume logs in the volume iscsi target and mounts the filesystem at the staging path,
+// it's done once per node and the pods on the node share the session and the mount.
+// If info.VolumeInfo.Local is set the logical volume is used directly without iscsi
+func StageVolume(vol *apis.Volume, info *mtypes.StageInfo, iscsiUsername, iscsiPassword string) error {
+	// add lock to limit iscsi connector
+	Lock.Lock()
+	defer Lock.Unlock()
+
+	var err error
+	if info.VolumeInfo.Local {
+		err = connectLocalDevice(vol, info.VolumeInfo)
+	} else {
+		err = connectIscsiDevice(vol, info.VolumeInfo, iscsiUsername, iscsiPassword)
+	}
+
 	if err != nil {
 		return err
 	}
 
+	switch info.MountType {
+	case mtypes.TypeBlock:
+		// block volume is bind mounted from the device directly when publishing,
+		// the local logical volume is never set read only as the iscsi target shares it
+		if IsReadOnly(info.VolumeInfo) && !info.VolumeInfo.Local {
+			if err = setDeviceReadOnly(info.VolumeInfo.DevicePath); err != nil {
+				logger.StdLog.Errorf("node stage volume %s set device %s read only error %v", vol.Name, info.VolumeInfo.DevicePath, err)
+				return err
+			}
+		}
+	case mtypes.TypeFileSystem:
+		mountInfo := *info.VolumeInfo
+		if IsReadOnly(info.VolumeInfo) {
+			mountInfo.MountOptions = append(append([]string{}, mountInfo.MountOptions...), readOnlyMountOptions(mountInfo.FSType)...)
+		}
+
+		err = MountFilesystem(vol, &mountInfo, nil)
+		if err != nil {
+			logger.StdLog.Errorf("node stage volume %s fails %v with error %v", vol.Name, info.VolumeInfo, err)
+			return err
+		}
+	}
+
+	// record the stage info so that publish and unstage can find the device
+	stageNodes := make([]*mtypes.StageInfo, 0, len(vol.Spec.StageNodes)+1)
+	for _, stageInfo := range vol.Spec.StageNodes {
+		if stageInfo.NodeId == info.NodeId {
+			if equality.Semantic.DeepEqual(stageInfo, info) {
+				logger.StdLog.Infof("node stage volume %s already recorded on node %s", vol.Name, info.NodeId)
+				return nil
+			}
+			continue
+		}
+
+		stageNodes = append(stageNodes, stageInfo)
+	}
+
+	vol.Spec.StageNodes = append(stageNodes, info)
+	newVol, err := crd.UpdateVolume(vol)
+	if err != nil {
+		logger.StdLog.Errorf("update volume %s stage nodes error %v", vol.Name, err)
+		return fmt.Errorf("update volume error %v", err)
+	}
+	*vol = *newVol
+
+	logger.StdLog.Info("node stage volume", vol.Name, info.NodeId, info.VolumeInfo)
+	return nil
+}
+
+// UnstageVolume unmounts the staging path and logs out the volume iscsi session on the node
+func UnstageVolume(vol *apis.Volume, nodeID, stagingPath, iscsiUsername, iscsiPassword string) error {
 	// add lock to limit iscsi connector
 	Lock.Lock()
 	defer Lock.Unlock()
 
+	var rawDevicePaths []string
+	isLocal := false
+	stageNodes := make([]*mtypes.StageInfo, 0, len(vol.Spec.StageNodes))
+	for _, stageInfo := range vol.Spec.StageNodes {
+		if stageInfo.NodeId == nodeID {
+			if stageInfo.VolumeInfo != nil {
+				rawDevicePaths = stageInfo.VolumeInfo.RawDevicePaths
+				isLocal = stageInfo.VolumeInfo.Local
+			}
+			continue
+		}
+
+		stageNodes = append(stageNodes, stageInfo)
+	}
+
+	if err := UnmountPath(stagingPath); err != nil {
+		logger.StdLog.Errorf("unmount volume %s staging path %s error %v", vol.Name, stagingPath, err)
+		return err
+	}
+
+	// local volume has no iscsi session to disconnect
+	if !isLocal {
+		connector, err := NewIscsiConnector(vol, iscsiUsername, iscsiPassword)
+		if err != nil {
+			return err
+		}
+
+		// disconnect volume device
+		err = connector.DisconnectVolume(rawDevicePaths)
+		if err != nil {
+			logger.StdLog.Errorf("disconnect volume %s devices %v error %v", vol.Name, rawDevicePaths, err)
+		}
+
+		// disconnect iscsi session
+		connector.Disconnect()
+	}
+
+	if len(stageNodes) != len(vol.Spec.StageNodes) {
+		vol.Spec.StageNodes = stageNodes
+		newVol, err := crd.UpdateVolume(vol)
+		if err != nil {
+			logger.StdLog.Errorf("update volume %s stage nodes error %v", vol.Name, err)
+			return fmt.Errorf("update volume error %v", err)
+		}
+		*vol = *newVol
+	}
+
+	logger.StdLog.Infof("unstage done %s path %v local %v", vol.Name, stagingPath, isLocal)
+	return nil
+}
+
+// connectIscsiDevice logs in the volume iscsi target and records the device paths to info
+func connectIscsiDevice(vol *apis.Volume, info *mtypes.VolumeInfo, iscsiUsername, iscsiPassword string) error {
+	connector, err := NewIscsiConnector(vol, iscsiUsername, iscsiPassword)
+	if err != nil {
+		return err
+	}
+
 	devicePath, rawDevicePaths, connectErr := connector.Connect()
 	if connectErr != nil {
 		logger.StdLog.Error(connectErr)
@@ -55,24 +177,40 @@ func MountVolume(vol *apis.Volume, info *mtypes.Info, iscsiUsername, iscsiPasswo
 		return fmt.Errorf("connect reported success, but no path returned")
 	}
 
-	info.VolumeInfo.DevicePath = devicePath
-	info.VolumeInfo.RawDevicePaths = rawDevicePaths
+	info.DevicePath = devicePath
+	info.RawDevicePaths = rawDevicePaths
+	return nil
+}
 
-	// check mount node info has added or append to
-	hasAddMountNode := false
-	for _, mountNode := range vol.Spec.MountNodes {
-		if mountNode.PodInfo.UID == info.PodInfo.UID {
-			hasAddMountNode = true
-		}
+// connectLocalDevice uses the logical volume device on the owner node directly,
+// it saves the iscsi loopback round trip. The device mapper path is used as it's
+// the path recorded by mount(8) in /proc/mounts
+func connectLocalDevice(vol *apis.Volume, info *mtypes.VolumeInfo) error {
+	devicePath, _ := GetLVMVolumeDevPath(vol)
+	if _, err := os.Stat(devicePath); err != nil {
+		logger.StdLog.Errorf("local device %s of volume %s error %v", devicePath, vol.Name, err)
+		return status.Errorf(codes.Internal, "local device %s of volume %s error %v", devicePath, vol.Name, err)
 	}
 
-	if !hasAddMountNode {
-		vol.Spec.MountNodes = append(vol.Spec.MountNodes, info)
-		vol, err := crd.UpdateVolume(vol)
-		if err != nil {
-			logger.StdLog.Errorf("update volume %s mount nodes error %v", vol.Name, err)
-			return fmt.Errorf("update volume error %v", err)
-		}
+	info.DevicePath = devicePath
+	info.RawDevicePaths = nil
+	return nil
+}
+
+// PublishVolume bind mounts the volume staged on the node to the pod target path
+func PublishVolume(vol *apis.Volume, info *mtypes.Info, stagingPath string) error {
+	stageInfo := GetStageInfo(vol, info.PodInfo.NodeId)
+	if stageInfo == nil || stageInfo.VolumeInfo == nil {
+		return status.Errorf(codes.FailedPrecondition, "volume %s is not staged on node %s", vol.Name, info.PodInfo.NodeId)
+	}
+
+	info.VolumeInfo.DevicePath = stageInfo.VolumeInfo.DevicePath
+	info.VolumeInfo.RawDevicePaths = stageInfo.VolumeInfo.RawDevicePaths
+	info.VolumeInfo.Local = stageInfo.VolumeInfo.Local
+
+	err := addMountNode(vol, info)
+	if err != nil {
+		return err
 	}
 
 	switch info.MountType {
@@ -80,8 +218,8 @@ func MountVolume(vol *apis.Volume, info *mtypes.Info, iscsiUsername, iscsiPasswo
 		// attempt block mount operation on the requested path
 		err = MountBlock(vol, info.VolumeInfo, info.PodInfo)
 	case mtypes.TypeFileSystem:
-		// attempt filesystem mount operation on the requested path
-		err = MountFilesystem(vol, info.VolumeInfo, info.PodInfo)
+		// attempt bind mount of the staging path on the requested path
+		err = BindFilesystem(vol, stagingPath, info.VolumeInfo, info.PodInfo)
 	}
 
 	if err != nil {
@@ -93,6 +231,62 @@ func MountVolume(vol *apis.Volume, info *mtypes.Info, iscsiUsername, iscsiPasswo
 	return nil
 }
 
+// MountEphemeralVolume formats and mounts the logical volume of an ephemeral inline volume
+// at the pod target path, the volume is always created on the node of the pod
+func MountEphemeralVolume(vol *apis.Volume, info *mtypes.Info) error {
+	Lock.Lock()
+	defer Lock.Unlock()
+
+	info.VolumeInfo.Local = true
+	err := connectLocalDevice(vol, info.VolumeInfo)
+	if err != nil {
+		return err
+	}
+
+	if err = addMountNode(vol, info); err != nil {
+		return err
+	}
+
+	err = MountFilesystem(vol, info.VolumeInfo, info.PodInfo)
+	if err != nil {
+		logger.StdLog.Errorf("node publish ephemeral volume fails %v %v with error %v", info.PodInfo, info.VolumeInfo, err)
+		return err
+	}
+
+	logger.StdLog.Info("node publish ephemeral volume", info.PodInfo, info.VolumeInfo)
+	return nil
+}
+
+// addMountNode records the mount info of the pod to the volume if it's not recorded yet
+func addMountNode(vol *apis.Volume, info *mtypes.Info) error {
+	for _, mountNode := range vol.Spec.MountNodes {
+		if mountNode.PodInfo.UID == info.PodInfo.UID {
+			return nil
+		}
+	}
+
+	vol.Spec.MountNodes = append(vol.Spec.MountNodes, info)
+	newVol, err := crd.UpdateVolume(vol)
+	if err != nil {
+		logger.StdLog.Errorf("update volume %s mount nodes error %v", vol.Name, err)
+		return fmt.Errorf("update volume error %v", err)
+	}
+	*vol = *newVol
+
+	return nil
+}
+
+// GetStageInfo returns the stage info of the volume on node, nil is returned if it's not staged
+func GetStageInfo(vol *apis.Volume, nodeID string) *mtypes.StageInfo {
+	for _, stageInfo := range vol.Spec.StageNodes {
+		if stageInfo != nil && stageInfo.NodeId == nodeID {
+			return stageInfo
+		}
+	}
+
+	return nil
+}
+
 // MountFilesystem mounts the disk to the specified path
 func MountFilesystem(vol *apis.Volume, info *mtypes.VolumeInfo, podInfo *mtypes.PodInfo) error {
 	target := info.MountPath
@@ -135,11 +329,56 @@ func MountFilesystem(vol *apis.Volume, info *mtypes.VolumeInfo, podInfo *mtypes.
 	return nil
 }
 
+// BindFilesystem bind mounts the filesystem mounted at the staging path to the specified path
+func BindFilesystem(vol *apis.Volume, stagingPath string, info *mtypes.VolumeInfo, podInfo *mtypes.PodInfo) error {
+	target := info.MountPath
+	devicePath := info.DevicePath
+	mountOpt := []string{"bind"}
+	if IsReadOnly(info) {
+		mountOpt = append(mountOpt, "ro")
+	}
+
+	// create dir as mount point
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return status.Errorf(codes.Internal, "Could not create dir {%q}, err: %v", target, err)
+	}
+
+	mounted, err := verifyMountRequest(vol, devicePath, target)
+	if err != nil {
+		return err
+	}
+
+	if mounted {
+		logger.StdLog.Infof("lvm : already mounted %s => %s", vol, target)
+		return nil
+	}
+
+	mounter := &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: utilexec.New()}
+	if err := mounter.Mount(stagingPath, target, "", mountOpt); err != nil {
+		return status.Errorf(codes.Internal, "bind mount %s failed at %v err : %v", stagingPath, target, err)
+	}
+
+	logger.StdLog.Infof("NodePublishVolume bind mounted %s at %s", stagingPath, target)
+
+	if podInfo != nil {
+		if err = setIOLimits(vol, podInfo, devicePath); err != nil {
+			logger.StdLog.Warnf("lvm: error setting io limits: podUid %s, device %s, err=%v", podInfo.UID, devicePath, err)
+		} else {
+			logger.StdLog.Infof("lvm: io limits set for podUid %v, device %s", podInfo.UID, devicePath)
+		}
+	}
+
+	return nil
+}
+
 // MountBlock mounts the block disk to the specified path
 func MountBlock(vol *apis.Volume, info *mtypes.VolumeInfo, podLVInfo *mtypes.PodInfo) error {
 	target := info.MountPath
 	devicePath := info.DevicePath
 	mountOpt := []string{"bind"}
+	if IsReadOnly(info) {
+		mountOpt = append(mountOpt, "ro")
+	}
 
 	// Create the mount point as a file since bind mount device node requires it to be a file
 	err := makeFile(target)
@@ -246,3 +485,21 @@ func UmountVolume(vol *apis.Volume, targetPath, iscsiUsername, iscsiPassword str
 
 	return nil
 }
+
+// UnmountPath unmounts the path if it's mounted
+func UnmountPath(path string) error {
+	mounter := mount.New("")
+	notMnt, err := mounter.IsLikelyNotMountPoint(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if notMnt {
+		return nil
+	}
+
+	return mounter.Unmount(path)
+}
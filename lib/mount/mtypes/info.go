@@ -43,6 +43,11 @@ type VolumeInfo struct {
 	// +kubebuilder:validation:Optional
 	RawDevicePaths []string `json:"raw_device_paths"`
 
+	// Local is true when the volume is used on its owner node, the logical
+	// volume is mounted directly without the iscsi loopback
+	// +kubebuilder:validation:Optional
+	Local bool `json:"local,omitempty"`
+
 	// MountOptions specifies the options with
 	// which mount needs to be attempted
 	// +kubebuilder:validation:Optional
@@ -67,3 +72,16 @@ type PodInfo struct {
 	// +kubebuilder:validation:Optional
 	NodeId string `json:"node_id"`
 }
+
+// StageInfo contains the info of the volume staged on a node,
+// the iscsi session and filesystem mount are shared by the pods on the node
+type StageInfo struct {
+	// NodeId is the node id where the volume is staged
+	// +kubebuilder:validation:Optional
+	NodeId string `json:"node_id"`
+	// +kubebuilder:validation:Optional
+	MountType Type `json:"mount_type"`
+	// VolumeInfo.MountPath is the staging path of the volume
+	// +kubebuilder:validation:Optional
+	VolumeInfo *VolumeInfo `json:"volume_info"`
+}
@@ -0,0 +1,72 @@
+package mount
+
+import (
+	"fmt"
+	utilexec "k8s.io/utils/exec"
+	"k8s.io/utils/mount"
+	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/lib/mount/mtypes"
+	"qiniu.io/rio-csi/logger"
+)
+
+// ExpandVolume makes the node pick up the new size of an expanded volume:
+// the iscsi devices are rescanned and the filesystem on top of them is grown online
+func ExpandVolume(vol *apis.Volume, info *mtypes.Info, iscsiUsername, iscsiPassword string) error {
+	// local logical volume picks up the new size without rescan
+	if !info.VolumeInfo.Local {
+		connector, err := NewIscsiConnector(vol, iscsiUsername, iscsiPassword)
+		if err != nil {
+			return err
+		}
+
+		// add lock to limit iscsi connector
+		Lock.Lock()
+		defer Lock.Unlock()
+
+		err = connector.ResizeVolume(info.VolumeInfo.RawDevicePaths)
+		if err != nil {
+			logger.StdLog.Errorf("resize volume %s devices %v error %v", vol.Name, info.VolumeInfo.RawDevicePaths, err)
+			return err
+		}
+	}
+
+	// block volume has nothing more to grow
+	if info.MountType == mtypes.TypeBlock {
+		return nil
+	}
+
+	return ResizeFilesystem(info.VolumeInfo.DevicePath, info.VolumeInfo.MountPath)
+}
+
+// ResizeFilesystem grows the mounted filesystem on device to the whole device size,
+// supports ext3/ext4, xfs and btrfs
+func ResizeFilesystem(devicePath, mountPath string) error {
+	mounter := &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: utilexec.New()}
+	format, err := mounter.GetDiskFormat(devicePath)
+	if err != nil {
+		logger.StdLog.Errorf("get disk format of %s error %v", devicePath, err)
+		return err
+	}
+
+	var cmd utilexec.Cmd
+	switch format {
+	case "ext3", "ext4":
+		cmd = mounter.Exec.Command("resize2fs", devicePath)
+	case "xfs":
+		// xfs can only be grown through its mount point
+		cmd = mounter.Exec.Command("xfs_growfs", mountPath)
+	case "btrfs":
+		cmd = mounter.Exec.Command("btrfs", "filesystem", "resize", "max", mountPath)
+	default:
+		return fmt.Errorf("resize filesystem %q on %s is not supported", format, devicePath)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		logger.StdLog.Errorf("resize %s filesystem on %s error %v: %s", format, devicePath, err, string(out))
+		return fmt.Errorf("resize %s filesystem on %s error %v: %s", format, devicePath, err, string(out))
+	}
+
+	logger.StdLog.Infof("resized %s filesystem on %s mounted at %s", format, devicePath, mountPath)
+	return nil
+}
@@ -1,10 +1,13 @@
 package mount
 
 import (
+	"fmt"
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	utilexec "k8s.io/utils/exec"
 	"k8s.io/utils/mount"
 	"os"
 	apis "qiniu.io/rio-csi/api/rio/v1"
+	"qiniu.io/rio-csi/lib/mount/device"
 	"qiniu.io/rio-csi/lib/mount/mtypes"
 	"qiniu.io/rio-csi/logger"
 	"strings"
@@ -56,8 +59,11 @@ func GetMounts(dev string) ([]string, error) {
 	if mountList, err = mounter.List(); err != nil {
 		return nil, err
 	}
+	// the device is compared by its canonical path, eg. the lvm device mounted by /dev/<vg>/<lv>
+	// is recorded as /dev/mapper/<vg>-<lv> in /proc/mounts
+	dev = device.CanonicalPath(dev)
 	for _, mntInfo := range mountList {
-		if mntInfo.Device == dev {
+		if device.IsSameDevice(mntInfo.Device, dev) {
 			currentMounts = append(currentMounts, mntInfo.Path)
 		}
 	}
@@ -116,3 +122,45 @@ func makeFile(pathname string) error {
 	}
 	return nil
 }
+
+// IsReadOnly returns whether the volume is used read only by its access mode or mount options
+func IsReadOnly(info *mtypes.VolumeInfo) bool {
+	for _, mode := range info.AccessModes {
+		if mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY.String() ||
+			mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY.String() {
+			return true
+		}
+	}
+
+	for _, opt := range info.MountOptions {
+		if opt == "ro" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readOnlyMountOptions returns the options to mount the filesystem read only, the journal
+// must not be replayed either as the volume may be write-protected
+func readOnlyMountOptions(fsType string) []string {
+	switch fsType {
+	case "xfs":
+		return []string{"ro", "norecovery"}
+	case "", "ext3", "ext4":
+		// ext4 is the default fs type
+		return []string{"ro", "noload"}
+	default:
+		return []string{"ro"}
+	}
+}
+
+// setDeviceReadOnly sets the block device read only
+func setDeviceReadOnly(devicePath string) error {
+	out, err := utilexec.New().Command("blockdev", "--setro", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("blockdev --setro %s error %v: %s", devicePath, err, string(out))
+	}
+
+	return nil
+}
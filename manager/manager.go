@@ -3,6 +3,7 @@ package manager
 import (
 	"os"
 	"qiniu.io/rio-csi/logger"
+	"time"
 
 	riov1 "qiniu.io/rio-csi/api/rio/v1"
 
@@ -47,6 +48,9 @@ func StartManager(nodeID, namespace, metricsAddr, probeAddr, iscsiUsername, iscs
 	// start node manager
 	go nodeManager.Start()
 
+	// start check volume health
+	go controllers.StartVolumeHealthCheck(nodeID, time.Minute)
+
 	opts := zap.Options{
 		Development: true,
 	}
@@ -9,6 +9,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
@@ -127,6 +128,11 @@ func (m *NodeManager) Sync() error {
 		node = nodeStruct.DeepCopy()
 	}
 
+	// extend the thin pools reaching the autoextend threshold before reporting them
+	if err = lvm.ExtendThinPools(m.pendingVolumes()); err != nil {
+		logger.StdLog.Errorf("extend thin pools error %v", err)
+	}
+
 	vgs, err := lvm.ListVolumeGroup(true)
 	if err != nil {
 		logger.StdLog.Error(err)
@@ -207,6 +213,24 @@ func (m *NodeManager) Sync() error {
 	return nil
 }
 
+// pendingVolumes returns the volumes of the node which are not provisioned yet
+func (m *NodeManager) pendingVolumes() []*apis.Volume {
+	vols, err := client.DefaultInformer.Rio().V1().Volumes().Lister().Volumes(crd.RioNamespace).List(labels.Everything())
+	if err != nil {
+		logger.StdLog.Errorf("list volumes error %v", err)
+		return nil
+	}
+
+	pending := make([]*apis.Volume, 0)
+	for _, vol := range vols {
+		if vol.Spec.OwnerNodeID == m.NodeID && vol.Status.State == crd.StatusPending {
+			pending = append(pending, vol)
+		}
+	}
+
+	return pending
+}
+
 // getNodeStructuredObject Obj from queue is not readily in lvmnode type. This function would convert obj into lvmnode type.
 func getNodeStructuredObject(obj interface{}) (*apis.RioNode, bool) {
 	unstructuredInterface, ok := obj.(*unstructured.Unstructured)
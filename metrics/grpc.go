@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+var (
+	grpcRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the csi grpc requests.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"method"})
+
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "Count of the csi grpc requests by status code.",
+	}, []string{"method", "code"})
+)
+
+// ObserveGRPC records the latency and the status code of a finished csi grpc request
+func ObserveGRPC(method string, start time.Time, err error) {
+	grpcRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+}
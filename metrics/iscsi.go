@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"qiniu.io/rio-csi/lib/iscsi"
+	"qiniu.io/rio-csi/logger"
+)
+
+var (
+	iscsiSessionsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "iscsi", "sessions"),
+		"Count of the iscsi initiator sessions on the node by portal.", []string{"node", "portal"}, nil)
+	lioTargetsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "lio", "targets"),
+		"Count of the LIO iscsi targets on the node.", []string{"node"}, nil)
+	lioLunsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "lio", "luns"),
+		"Count of the luns of the LIO iscsi target.", []string{"node", "target"}, nil)
+	iscsiScrapeErrorDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "iscsi", "scrape_error"),
+		"1 if the last scrape of iscsi failed.", []string{"node"}, nil)
+)
+
+// iscsiCollector collects the initiator sessions and the LIO targets of the node when scraped
+type iscsiCollector struct {
+	nodeID string
+}
+
+// NewIscsiCollector returns the collector of the iscsi metrics on the node
+func NewIscsiCollector(nodeID string) prometheus.Collector {
+	return &iscsiCollector{nodeID: nodeID}
+}
+
+func (c *iscsiCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- iscsiSessionsDesc
+	ch <- lioTargetsDesc
+	ch <- lioLunsDesc
+	ch <- iscsiScrapeErrorDesc
+}
+
+func (c *iscsiCollector) Collect(ch chan<- prometheus.Metric) {
+	scrapeError := 0.0
+
+	sessions, err := iscsi.GetCurrentSessions()
+	if err != nil {
+		logger.StdLog.Errorf("metrics list iscsi sessions error %v", err)
+		scrapeError = 1
+	}
+
+	portalSessions := make(map[string]int)
+	for _, session := range sessions {
+		portalSessions[session.Portal]++
+	}
+
+	for portal, count := range portalSessions {
+		ch <- prometheus.MustNewConstMetric(iscsiSessionsDesc, prometheus.GaugeValue, float64(count), c.nodeID, portal)
+	}
+
+	targetLuns, err := iscsi.TargetLunCount()
+	if err != nil {
+		logger.StdLog.Errorf("metrics list lio targets error %v", err)
+		scrapeError = 1
+	} else {
+		ch <- prometheus.MustNewConstMetric(lioTargetsDesc, prometheus.GaugeValue, float64(len(targetLuns)), c.nodeID)
+		for target, count := range targetLuns {
+			ch <- prometheus.MustNewConstMetric(lioLunsDesc, prometheus.GaugeValue, float64(count), c.nodeID, target)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(iscsiScrapeErrorDesc, prometheus.GaugeValue, scrapeError, c.nodeID)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"qiniu.io/rio-csi/lib/lvm"
+	"qiniu.io/rio-csi/logger"
+)
+
+const lvSegTypeSnapshot = "snapshot"
+
+var (
+	vgSizeDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "vg", "size_bytes"),
+		"Size of the volume group.", []string{"node", "vg"}, nil)
+	vgFreeDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "vg", "free_bytes"),
+		"Free space of the volume group.", []string{"node", "vg"}, nil)
+	vgLVCountDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "vg", "lv_count"),
+		"Count of logical volumes in the volume group.", []string{"node", "vg"}, nil)
+	thinPoolDataDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "thin_pool", "data_used_percent"),
+		"Data usage percentage of the thin pool.", []string{"node", "vg", "pool"}, nil)
+	thinPoolMetadataDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "thin_pool", "metadata_used_percent"),
+		"Metadata usage percentage of the thin pool.", []string{"node", "vg", "pool"}, nil)
+	snapshotUsedDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "snapshot", "used_percent"),
+		"Usage percentage of the copy-on-write snapshot reserve.", []string{"node", "vg", "snapshot"}, nil)
+	lvmScrapeErrorDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "lvm", "scrape_error"),
+		"1 if the last scrape of lvm failed.", []string{"node"}, nil)
+)
+
+// lvmCollector collects the volume groups, thin pools and snapshots of the node when scraped
+type lvmCollector struct {
+	nodeID string
+}
+
+// NewLVMCollector returns the collector of the lvm metrics on the node
+func NewLVMCollector(nodeID string) prometheus.Collector {
+	return &lvmCollector{nodeID: nodeID}
+}
+
+func (c *lvmCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- vgSizeDesc
+	ch <- vgFreeDesc
+	ch <- vgLVCountDesc
+	ch <- thinPoolDataDesc
+	ch <- thinPoolMetadataDesc
+	ch <- snapshotUsedDesc
+	ch <- lvmScrapeErrorDesc
+}
+
+func (c *lvmCollector) Collect(ch chan<- prometheus.Metric) {
+	scrapeError := 0.0
+
+	vgs, err := lvm.ListVolumeGroup(false)
+	if err != nil {
+		logger.StdLog.Errorf("metrics list volume group error %v", err)
+		scrapeError = 1
+	}
+
+	for _, vg := range vgs {
+		ch <- prometheus.MustNewConstMetric(vgSizeDesc, prometheus.GaugeValue, float64(vg.Size.Value()), c.nodeID, vg.Name)
+		ch <- prometheus.MustNewConstMetric(vgFreeDesc, prometheus.GaugeValue, float64(vg.Free.Value()), c.nodeID, vg.Name)
+		ch <- prometheus.MustNewConstMetric(vgLVCountDesc, prometheus.GaugeValue, float64(vg.LVCount), c.nodeID, vg.Name)
+	}
+
+	lvs, err := lvm.ListLVMLogicalVolume()
+	if err != nil {
+		logger.StdLog.Errorf("metrics list logical volume error %v", err)
+		scrapeError = 1
+	}
+
+	for _, lv := range lvs {
+		switch lv.SegType {
+		case lvm.LVThinPool:
+			ch <- prometheus.MustNewConstMetric(thinPoolDataDesc, prometheus.GaugeValue, lv.UsedSizePercent, c.nodeID, lv.VGName, lv.Name)
+			ch <- prometheus.MustNewConstMetric(thinPoolMetadataDesc, prometheus.GaugeValue, lv.MetadataUsedPercent, c.nodeID, lv.VGName, lv.Name)
+		case lvSegTypeSnapshot:
+			ch <- prometheus.MustNewConstMetric(snapshotUsedDesc, prometheus.GaugeValue, lv.SnapshotUsedPercent, c.nodeID, lv.VGName, lv.Name)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(lvmScrapeErrorDesc, prometheus.GaugeValue, scrapeError, c.nodeID)
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"qiniu.io/rio-csi/conf"
+	"qiniu.io/rio-csi/logger"
+	"strings"
+)
+
+const (
+	// namespace is the prefix of all rio-csi metrics
+	namespace = "riocsi"
+
+	defaultMetricsPath = "/metrics"
+)
+
+// Start registers the grpc metrics and the given collectors and serves them at
+// config.MetricsAddr config.MetricsPath in background
+func Start(config *conf.Config, cs ...prometheus.Collector) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(grpcRequestDuration, grpcRequests)
+	registry.MustRegister(cs...)
+
+	if !config.DisableExporterMetrics {
+		registry.MustRegister(
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+			collectors.NewGoCollector(),
+		)
+	}
+
+	path := config.MetricsPath
+	if path == "" {
+		path = defaultMetricsPath
+	}
+
+	// metrics_addr in the config map can be a bare port, eg. 9099
+	addr := config.MetricsAddr
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	go func() {
+		logger.StdLog.Infof("start metrics server at %s%s", addr, path)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.StdLog.Errorf("metrics server %s error %v", addr, err)
+		}
+	}()
+}